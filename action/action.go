@@ -0,0 +1,7 @@
+package action
+
+// Exec actions for tasks that change existing entities through the admin api, shared by the parser and the job runner
+const (
+	ExecuteAPIPatch  = "api_patch"
+	ExecuteAPIDelete = "api_delete"
+)
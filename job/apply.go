@@ -0,0 +1,176 @@
+package job
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/agile-work/cli/action"
+	"github.com/agile-work/srv-shared/constants"
+
+	// postgres driver used by query tasks
+	_ "github.com/lib/pq"
+)
+
+// Task execution status
+const (
+	StatusSuccess = "success"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+)
+
+const apiHostParam = "{system.api_host}"
+
+var errNotFound = errors.New("404 Not Found")
+
+// Runner executes job tasks against a Horizon system
+type Runner struct {
+	APIHost  string
+	APIToken string
+	Client   *http.Client
+	DB       *sql.DB
+}
+
+// Result defines the execution result of a task
+type Result struct {
+	Task    Task
+	Address string
+	Status  string
+	Err     error
+}
+
+// NewRunner returns a runner configured to reach the target system
+func NewRunner(cfg *Config) (*Runner, error) {
+	r := &Runner{
+		APIHost:  strings.TrimRight(cfg.APIHost, "/"),
+		APIToken: cfg.APIToken,
+		Client:   http.DefaultClient,
+	}
+	if cfg.DSN != "" {
+		db, err := sql.Open("postgres", cfg.DSN)
+		if err != nil {
+			return nil, err
+		}
+		r.DB = db
+	}
+	return r, nil
+}
+
+// Close release the database connection
+func (r *Runner) Close() error {
+	if r.DB != nil {
+		return r.DB.Close()
+	}
+	return nil
+}
+
+// Apply execute the job tasks in sequence order and stop at the first failure
+func (r *Runner) Apply(j *Job) ([]Result, error) {
+	tasks := j.SortedTasks()
+	if err := r.check(tasks); err != nil {
+		return nil, err
+	}
+	results := []Result{}
+	var failure error
+	for _, t := range tasks {
+		result := Result{
+			Task:    t,
+			Address: resolveAddress(t.ExecAddress, r.APIHost),
+		}
+		if failure != nil {
+			result.Status = StatusSkipped
+			results = append(results, result)
+			continue
+		}
+		if err := r.execute(t, result.Address); err != nil {
+			result.Status = StatusFailed
+			result.Err = err
+			failure = fmt.Errorf("task %s %s sequence %d %s %s: %s", t.Type, t.Code, t.Sequence, t.ExecAction, result.Address, err.Error())
+		} else {
+			result.Status = StatusSuccess
+		}
+		results = append(results, result)
+	}
+	return results, failure
+}
+
+// check ensures the runner can reach everything the tasks need before any of them change the system
+func (r *Runner) check(tasks []Task) error {
+	for _, t := range tasks {
+		switch t.ExecAction {
+		case constants.ExecuteQuery:
+			if r.DB == nil {
+				return fmt.Errorf("database not configured, task %s %s sequence %d runs a query", t.Type, t.Code, t.Sequence)
+			}
+		case constants.ExecuteAPIPost, action.ExecuteAPIPatch, action.ExecuteAPIDelete:
+			if r.APIHost == "" {
+				return fmt.Errorf("api host not configured, task %s %s sequence %d calls the api", t.Type, t.Code, t.Sequence)
+			}
+		default:
+			return fmt.Errorf("task %s %s sequence %d: unsupported exec action %s", t.Type, t.Code, t.Sequence, t.ExecAction)
+		}
+	}
+	return nil
+}
+
+func (r *Runner) execute(t Task, address string) error {
+	switch t.ExecAction {
+	case constants.ExecuteAPIPost:
+		return r.executeAPI(http.MethodPost, address, t.ExecPayload)
+	case action.ExecuteAPIPatch:
+		return r.executeAPI(http.MethodPatch, address, t.ExecPayload)
+	case action.ExecuteAPIDelete:
+		err := r.executeAPI(http.MethodDelete, address, nil)
+		if t.IfExists && err == errNotFound {
+			return nil
+		}
+		return err
+	case constants.ExecuteQuery:
+		return r.executeQuery(t.ExecPayload)
+	}
+	return fmt.Errorf("unsupported exec action %s", t.ExecAction)
+}
+
+func (r *Runner) executeAPI(method, address string, payload json.RawMessage) error {
+	if r.APIHost == "" {
+		return errors.New("api host not configured")
+	}
+	req, err := http.NewRequest(method, address, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.APIToken != "" {
+		req.Header.Set("Authorization", r.APIToken)
+	}
+	res, err := r.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		resBody, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(resBody)))
+	}
+	return nil
+}
+
+func (r *Runner) executeQuery(payload json.RawMessage) error {
+	if r.DB == nil {
+		return errors.New("database not configured")
+	}
+	query := ""
+	if err := json.Unmarshal(payload, &query); err != nil {
+		return err
+	}
+	_, err := r.DB.Exec(query)
+	return err
+}
@@ -0,0 +1,187 @@
+package job
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/agile-work/cli/action"
+	"github.com/agile-work/srv-shared/constants"
+)
+
+type recordedRequest struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+// standIn records every request and answers with the status configured for its path, 200 otherwise
+type standIn struct {
+	mu       sync.Mutex
+	statuses map[string]int
+	requests []recordedRequest
+}
+
+func (s *standIn) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	s.mu.Lock()
+	s.requests = append(s.requests, recordedRequest{Method: req.Method, Path: req.URL.Path, Body: string(body)})
+	status, ok := s.statuses[req.URL.Path]
+	s.mu.Unlock()
+	if !ok {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+}
+
+func newStandIn(t *testing.T, statuses map[string]int) (*standIn, *Runner) {
+	s := &standIn{statuses: statuses}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return s, &Runner{APIHost: server.URL, Client: server.Client()}
+}
+
+func apiTask(taskType, code string, sequence int, action, path string) Task {
+	return Task{
+		Type:        taskType,
+		Code:        code,
+		Sequence:    sequence,
+		ExecAction:  action,
+		ExecAddress: apiHostParam + path,
+		ExecPayload: json.RawMessage(`{"code":"` + code + `"}`),
+	}
+}
+
+func TestApplyRunsTasksInSequenceOrder(t *testing.T) {
+	s, runner := newStandIn(t, nil)
+	j := &Job{Tasks: []Task{
+		apiTask("createField", "title", 2, constants.ExecuteAPIPost, "/api/v1/core/admin/schemas/tasks/fields"),
+		apiTask("createContent", "mdl", 0, constants.ExecuteAPIPost, "/api/v1/core/admin/contents"),
+		apiTask("updateSchema", "tasks", 1, action.ExecuteAPIPatch, "/api/v1/core/admin/schemas/tasks"),
+		apiTask("createSchema", "other", 1, constants.ExecuteAPIPost, "/api/v1/core/admin/schemas"),
+	}}
+
+	results, err := runner.Apply(j)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	expected := []recordedRequest{
+		{Method: http.MethodPost, Path: "/api/v1/core/admin/contents"},
+		{Method: http.MethodPatch, Path: "/api/v1/core/admin/schemas/tasks"},
+		{Method: http.MethodPost, Path: "/api/v1/core/admin/schemas"},
+		{Method: http.MethodPost, Path: "/api/v1/core/admin/schemas/tasks/fields"},
+	}
+	if len(s.requests) != len(expected) {
+		t.Fatalf("expected %d requests, found %d", len(expected), len(s.requests))
+	}
+	for i, req := range expected {
+		if s.requests[i].Method != req.Method || s.requests[i].Path != req.Path {
+			t.Errorf("request %d: expected %s %s, found %s %s", i, req.Method, req.Path, s.requests[i].Method, s.requests[i].Path)
+		}
+	}
+	if s.requests[0].Body != `{"code":"mdl"}` {
+		t.Errorf("expected the task payload as body, found %s", s.requests[0].Body)
+	}
+	for _, result := range results {
+		if result.Status != StatusSuccess {
+			t.Errorf("task %s: expected %s, found %s", result.Task.Code, StatusSuccess, result.Status)
+		}
+		if strings.Contains(result.Address, apiHostParam) || !strings.HasPrefix(result.Address, runner.APIHost) {
+			t.Errorf("task %s: api host not resolved in %s", result.Task.Code, result.Address)
+		}
+	}
+}
+
+func TestApplyRunsDeletesDeepestFirst(t *testing.T) {
+	s, runner := newStandIn(t, nil)
+	j := &Job{Tasks: []Task{
+		apiTask("deleteSchema", "tasks", 1, action.ExecuteAPIDelete, "/api/v1/core/admin/schemas/tasks"),
+		apiTask("deleteField", "title", 2, action.ExecuteAPIDelete, "/api/v1/core/admin/schemas/tasks/fields/title"),
+		apiTask("createSchema", "tasks", 1, constants.ExecuteAPIPost, "/api/v1/core/admin/schemas"),
+	}}
+
+	if _, err := runner.Apply(j); err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	if len(s.requests) != 3 {
+		t.Fatalf("expected 3 requests, found %d", len(s.requests))
+	}
+	expected := []string{
+		"DELETE /api/v1/core/admin/schemas/tasks/fields/title",
+		"DELETE /api/v1/core/admin/schemas/tasks",
+		"POST /api/v1/core/admin/schemas",
+	}
+	for i, req := range s.requests {
+		if found := req.Method + " " + req.Path; found != expected[i] {
+			t.Errorf("request %d: expected %s, found %s", i, expected[i], found)
+		}
+	}
+}
+
+func TestApplySkipsTasksAfterFailure(t *testing.T) {
+	s, runner := newStandIn(t, map[string]int{"/api/v1/core/admin/schemas": http.StatusInternalServerError})
+	j := &Job{Tasks: []Task{
+		apiTask("createContent", "mdl", 0, constants.ExecuteAPIPost, "/api/v1/core/admin/contents"),
+		apiTask("createSchema", "tasks", 1, constants.ExecuteAPIPost, "/api/v1/core/admin/schemas"),
+		apiTask("createField", "title", 2, constants.ExecuteAPIPost, "/api/v1/core/admin/schemas/tasks/fields"),
+	}}
+
+	results, err := runner.Apply(j)
+	if err == nil {
+		t.Fatal("expected the failure of createSchema")
+	}
+	if !strings.Contains(err.Error(), "createSchema tasks sequence 1") {
+		t.Errorf("expected the failed task in the error, found %s", err.Error())
+	}
+	statuses := []string{StatusSuccess, StatusFailed, StatusSkipped}
+	for i, result := range results {
+		if result.Status != statuses[i] {
+			t.Errorf("task %s: expected %s, found %s", result.Task.Code, statuses[i], result.Status)
+		}
+	}
+	if len(s.requests) != 2 {
+		t.Errorf("expected 2 requests before stopping, found %d", len(s.requests))
+	}
+}
+
+func TestApplyIfExistsAcceptsNotFound(t *testing.T) {
+	_, runner := newStandIn(t, map[string]int{
+		"/api/v1/core/admin/datasets/ds_gone":  http.StatusNotFound,
+		"/api/v1/core/admin/datasets/ds_other": http.StatusNotFound,
+	})
+
+	optional := apiTask("deleteDataset", "ds_gone", 1, action.ExecuteAPIDelete, "/api/v1/core/admin/datasets/ds_gone")
+	optional.IfExists = true
+	results, err := runner.Apply(&Job{Tasks: []Task{optional}})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	if results[0].Status != StatusSuccess {
+		t.Errorf("expected %s, found %s", StatusSuccess, results[0].Status)
+	}
+
+	required := apiTask("deleteDataset", "ds_other", 1, action.ExecuteAPIDelete, "/api/v1/core/admin/datasets/ds_other")
+	if _, err := runner.Apply(&Job{Tasks: []Task{required}}); err == nil {
+		t.Error("expected 404 to fail a delete without ifExists")
+	}
+}
+
+func TestApplyRequiresDatabaseForQueries(t *testing.T) {
+	s, runner := newStandIn(t, nil)
+	j := &Job{Tasks: []Task{
+		apiTask("createContent", "mdl", 0, constants.ExecuteAPIPost, "/api/v1/core/admin/contents"),
+		{Type: "createColumn", Code: "assignments", Sequence: 2, ExecAction: constants.ExecuteQuery, ExecPayload: json.RawMessage(`"select 1"`)},
+	}}
+
+	results, err := runner.Apply(j)
+	if err == nil || !strings.Contains(err.Error(), "database not configured") {
+		t.Fatalf("expected database not configured, found %v", err)
+	}
+	if len(results) != 0 || len(s.requests) != 0 {
+		t.Errorf("expected no task to run, found %d results and %d requests", len(results), len(s.requests))
+	}
+}
@@ -0,0 +1,29 @@
+package job
+
+import (
+	"encoding/json"
+	"io/ioutil"
+)
+
+// Config defines the target system used to apply a job
+type Config struct {
+	APIHost  string `json:"api_host"`
+	APIToken string `json:"api_token"`
+	DSN      string `json:"dsn"`
+}
+
+// LoadConfig read the target system configuration from a json file
+func LoadConfig(configFile string) (*Config, error) {
+	cfg := &Config{}
+	if configFile == "" {
+		return cfg, nil
+	}
+	configByte, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(configByte, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
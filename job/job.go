@@ -0,0 +1,73 @@
+package job
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/agile-work/cli/action"
+)
+
+// Job defines the task list generated by the xml parser
+type Job struct {
+	Version      string                 `json:"version"`
+	LanguageCode string                 `json:"language_code"`
+	ContentCode  string                 `json:"content_code"`
+	Params       map[string]interface{} `json:"params"`
+	Tasks        []Task                 `json:"tasks"`
+}
+
+// Task defines a single job task
+type Task struct {
+	Type        string          `json:"type"`
+	Code        string          `json:"code"`
+	Sequence    int             `json:"sequence"`
+	ExecAction  string          `json:"exec_action"`
+	ExecAddress string          `json:"exec_address"`
+	ExecPayload json.RawMessage `json:"exec_payload"`
+	IfExists    bool            `json:"if_exists,omitempty"`
+}
+
+// Load read a job from a json file generated by the xml parser
+func Load(jobFile string) (*Job, error) {
+	jobByte, err := ioutil.ReadFile(jobFile)
+	if err != nil {
+		return nil, err
+	}
+	j := &Job{}
+	if err := json.Unmarshal(jobByte, j); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// SortedTasks returns the delete tasks deepest first, so children go before the entities they belong to or reference,
+// followed by the other tasks ordered by sequence, the xml order is kept inside each sequence
+func (j *Job) SortedTasks() []Task {
+	tasks := make([]Task, len(j.Tasks))
+	copy(tasks, j.Tasks)
+	sort.SliceStable(tasks, func(i, k int) bool {
+		iDelete, kDelete := tasks[i].isDelete(), tasks[k].isDelete()
+		switch {
+		case iDelete != kDelete:
+			return iDelete
+		case iDelete:
+			return tasks[i].Sequence > tasks[k].Sequence
+		}
+		return tasks[i].Sequence < tasks[k].Sequence
+	})
+	return tasks
+}
+
+// isDelete reports tasks that remove an entity or a column
+func (t Task) isDelete() bool {
+	return t.ExecAction == action.ExecuteAPIDelete || strings.HasPrefix(t.Type, "delete") || strings.HasPrefix(t.Type, "drop")
+}
+
+func resolveAddress(address, apiHost string) string {
+	if apiHost == "" {
+		return address
+	}
+	return strings.Replace(address, apiHostParam, apiHost, -1)
+}
@@ -0,0 +1,95 @@
+package job
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/agile-work/cli/action"
+	"github.com/agile-work/srv-shared/constants"
+)
+
+// Plan write a human readable description of what each task would do grouped by sequence level
+func (j *Job) Plan(w io.Writer, apiHost string) error {
+	apiHost = strings.TrimRight(apiHost, "/")
+	counts := make(map[string]int)
+	types := []string{}
+	codeWidth := 0
+	for _, t := range j.Tasks {
+		if len(t.Code) > codeWidth {
+			codeWidth = len(t.Code)
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "Job plan for %s version %s\n", j.ContentCode, j.Version); err != nil {
+		return err
+	}
+
+	// deletes run deepest first before the other tasks, so they are grouped under their own sequence headers
+	header := ""
+	for _, t := range j.SortedTasks() {
+		taskHeader := fmt.Sprintf("Sequence %d", t.Sequence)
+		if t.isDelete() {
+			taskHeader += " deletes"
+		}
+		if taskHeader != header {
+			header = taskHeader
+			if _, err := fmt.Fprintf(w, "\n%s:\n", header); err != nil {
+				return err
+			}
+		}
+
+		taskType := t.Type
+		if taskType == "" {
+			taskType = t.ExecAction
+		}
+		if _, ok := counts[taskType]; !ok {
+			types = append(types, taskType)
+		}
+		counts[taskType]++
+
+		if _, err := fmt.Fprintf(
+			w, "%s%s %-16s %-*s %-6s %s\n",
+			strings.Repeat("  ", t.Sequence+1), planSymbol(taskType), taskType, codeWidth, t.Code,
+			planVerb(t.ExecAction), resolveAddress(t.ExecAddress, apiHost),
+		); err != nil {
+			return err
+		}
+	}
+
+	sort.Strings(types)
+	summary := []string{}
+	for _, taskType := range types {
+		summary = append(summary, fmt.Sprintf("%d %s", counts[taskType], taskType))
+	}
+	_, err := fmt.Fprintf(w, "\nPlan: %d tasks (%s)\n", len(j.Tasks), strings.Join(summary, ", "))
+	return err
+}
+
+func planSymbol(taskType string) string {
+	switch {
+	case strings.HasPrefix(taskType, "create"):
+		return "+"
+	case strings.HasPrefix(taskType, "update"):
+		return "~"
+	case strings.HasPrefix(taskType, "delete"), strings.HasPrefix(taskType, "drop"):
+		return "-"
+	}
+	return "*"
+}
+
+func planVerb(execAction string) string {
+	switch execAction {
+	case constants.ExecuteAPIPost:
+		return http.MethodPost
+	case action.ExecuteAPIPatch:
+		return http.MethodPatch
+	case action.ExecuteAPIDelete:
+		return http.MethodDelete
+	case constants.ExecuteQuery:
+		return "QUERY"
+	}
+	return strings.ToUpper(execAction)
+}
@@ -0,0 +1,62 @@
+package job
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/agile-work/cli/action"
+	"github.com/agile-work/srv-shared/constants"
+)
+
+func TestPlanGroupsTasksBySequence(t *testing.T) {
+	j := &Job{ContentCode: "mdl", Version: "1.1", Tasks: []Task{
+		apiTask("createContent", "mdl", 0, constants.ExecuteAPIPost, "/api/v1/core/admin/contents"),
+		apiTask("deleteSchema", "old", 1, action.ExecuteAPIDelete, "/api/v1/core/admin/schemas/old"),
+		apiTask("createSchema", "tasks", 1, constants.ExecuteAPIPost, "/api/v1/core/admin/schemas"),
+		apiTask("deleteField", "title", 2, action.ExecuteAPIDelete, "/api/v1/core/admin/schemas/old/fields/title"),
+		apiTask("createField", "owner", 2, constants.ExecuteAPIPost, "/api/v1/core/admin/schemas/tasks/fields"),
+		apiTask("updateSchema", "other", 1, action.ExecuteAPIPatch, "/api/v1/core/admin/schemas/other"),
+	}}
+
+	out := &bytes.Buffer{}
+	if err := j.Plan(out, "https://horizon"); err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	plan := out.String()
+
+	headers := []string{"Sequence 2 deletes:", "Sequence 1 deletes:", "Sequence 0:", "Sequence 1:", "Sequence 2:"}
+	position := -1
+	for _, header := range headers {
+		if count := strings.Count(plan, "\n"+header+"\n"); count != 1 {
+			t.Errorf("expected header %s once, found %d times in\n%s", header, count, plan)
+			continue
+		}
+		next := strings.Index(plan, "\n"+header+"\n")
+		if next < position {
+			t.Errorf("expected header %s after the previous one in\n%s", header, plan)
+		}
+		position = next
+	}
+
+	tests := []struct {
+		header string
+		line   string
+	}{
+		{"Sequence 2 deletes:", "- deleteField      title DELETE https://horizon/api/v1/core/admin/schemas/old/fields/title"},
+		{"Sequence 1 deletes:", "- deleteSchema     old   DELETE https://horizon/api/v1/core/admin/schemas/old"},
+		{"Sequence 1:", "~ updateSchema     other PATCH  https://horizon/api/v1/core/admin/schemas/other"},
+		{"Sequence 2:", "+ createField      owner POST   https://horizon/api/v1/core/admin/schemas/tasks/fields"},
+	}
+	for _, test := range tests {
+		section := plan[strings.Index(plan, "\n"+test.header+"\n"):]
+		section = section[:strings.Index(section[1:], "\n\n")+1]
+		if !strings.Contains(section, test.line) {
+			t.Errorf("expected %q under %s, found\n%s", test.line, test.header, section)
+		}
+	}
+
+	if !strings.Contains(plan, "Plan: 6 tasks (1 createContent, 1 createField, 1 createSchema, 1 deleteField, 1 deleteSchema, 1 updateSchema)") {
+		t.Errorf("unexpected summary in\n%s", plan)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/agile-work/cli/job"
 	xmlParser "github.com/agile-work/cli/parser/xml"
 )
 
@@ -15,15 +16,74 @@ func main() {
 	parse := jobCommand.String("parse", "", "XML file to parse.")
 	translation := jobCommand.String("translation", "", "CSV file to make translation.")
 	jsonTasks := jobCommand.String("json", "", "JSON file to save the xml parse.")
+	allowlist := jobCommand.String("allowlist", "", "File listing entities that already exist on the target system.")
+	allowDuplicates := jobCommand.Bool("allow-duplicates", false, "Parse even if duplicate codes are found.")
+	scaleTolerance := jobCommand.Float64("scale-tolerance", xmlParser.DefaultScaleTolerance, "Accepted deviation of reciprocal scale rates.")
+
+	applyCommand := flag.NewFlagSet("apply", flag.ExitOnError)
+	applyJSON := applyCommand.String("json", "", "JSON file generated by the xml parse.")
+	applyConfig := applyCommand.String("config", "", "JSON file with the target system configuration.")
+	applyHost := applyCommand.String("host", "", "Horizon API host replacing {system.api_host}.")
+	applyToken := applyCommand.String("token", "", "Authorization token sent to the Horizon API.")
+	applyDSN := applyCommand.String("dsn", "", "Postgres DSN used to run query tasks.")
+
+	planCommand := flag.NewFlagSet("plan", flag.ExitOnError)
+	planJSON := planCommand.String("json", "", "JSON file generated by the xml parse.")
+	planHost := planCommand.String("host", "", "Horizon API host replacing {system.api_host}.")
+
+	validateCommand := flag.NewFlagSet("validate", flag.ExitOnError)
+	validateXML := validateCommand.String("parse", "", "XML file to validate.")
+	validateAllowlist := validateCommand.String("allowlist", "", "File listing entities that already exist on the target system.")
+	validateAllowDuplicates := validateCommand.Bool("allow-duplicates", false, "Ignore duplicate codes.")
+	validateScaleTolerance := validateCommand.Float64("scale-tolerance", xmlParser.DefaultScaleTolerance, "Accepted deviation of reciprocal scale rates.")
+
+	diffCommand := flag.NewFlagSet("diff", flag.ExitOnError)
+	diffFrom := diffCommand.String("from", "", "XML file of the installed module version.")
+	diffTo := diffCommand.String("to", "", "XML file of the new module version.")
+	diffTranslation := diffCommand.String("translation", "", "CSV file to make translation of the new version.")
+	diffJSON := diffCommand.String("json", "", "JSON file to save the upgrade job.")
+	diffAllowlist := diffCommand.String("allowlist", "", "File listing entities that already exist on the target system.")
+	diffScaleTolerance := diffCommand.Float64("scale-tolerance", xmlParser.DefaultScaleTolerance, "Accepted deviation of reciprocal scale rates.")
+
+	exportCommand := flag.NewFlagSet("export", flag.ExitOnError)
+	exportContent := exportCommand.String("content", "", "Content code of the module to export.")
+	exportXML := exportCommand.String("xml", "", "XML file to save the module.")
+	exportTranslation := exportCommand.String("translation", "", "CSV file to save the module translations.")
+	exportLanguage := exportCommand.String("language", "en-us", "Default language of the module xml.")
+	exportConfig := exportCommand.String("config", "", "JSON file with the target system configuration.")
+	exportHost := exportCommand.String("host", "", "Horizon API host to read the module from.")
+	exportToken := exportCommand.String("token", "", "Authorization token sent to the Horizon API.")
 
 	if len(os.Args) < 2 {
-		fmt.Println("job subcommand is required")
+		fmt.Println("job or module subcommand is required")
 		os.Exit(1)
 	}
 
 	switch os.Args[1] {
 	case "job":
-		jobCommand.Parse(os.Args[2:])
+		subcommand := ""
+		if len(os.Args) > 2 {
+			subcommand = os.Args[2]
+		}
+		switch subcommand {
+		case "apply":
+			applyCommand.Parse(os.Args[3:])
+		case "plan":
+			planCommand.Parse(os.Args[3:])
+		case "validate":
+			validateCommand.Parse(os.Args[3:])
+		case "diff":
+			diffCommand.Parse(os.Args[3:])
+		default:
+			jobCommand.Parse(os.Args[2:])
+		}
+	case "module":
+		if len(os.Args) > 2 && os.Args[2] == "export" {
+			exportCommand.Parse(os.Args[3:])
+		} else {
+			fmt.Println("export subcommand is required")
+			os.Exit(1)
+		}
 	default:
 		flag.PrintDefaults()
 		os.Exit(1)
@@ -34,9 +94,145 @@ func main() {
 			jobCommand.PrintDefaults()
 			os.Exit(1)
 		}
-		if err := xmlParser.Process(*parse, *translation, *jsonTasks); err != nil {
+		if err := xmlParser.Process(*parse, *translation, *jsonTasks, xmlParser.Options{
+			AllowlistFile:   *allowlist,
+			AllowDuplicates: *allowDuplicates,
+			ScaleTolerance:  *scaleTolerance,
+		}); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if applyCommand.Parsed() {
+		if *applyJSON == "" {
+			applyCommand.PrintDefaults()
+			os.Exit(1)
+		}
+		if err := apply(*applyJSON, *applyConfig, *applyHost, *applyToken, *applyDSN); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if planCommand.Parsed() {
+		if *planJSON == "" {
+			planCommand.PrintDefaults()
+			os.Exit(1)
+		}
+		j, err := job.Load(*planJSON)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		if err := j.Plan(os.Stdout, *planHost); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if validateCommand.Parsed() {
+		if *validateXML == "" {
+			validateCommand.PrintDefaults()
+			os.Exit(1)
+		}
+		violations, err := xmlParser.Validate(*validateXML, xmlParser.Options{
+			AllowlistFile:   *validateAllowlist,
+			AllowDuplicates: *validateAllowDuplicates,
+			ScaleTolerance:  *validateScaleTolerance,
+		})
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		for _, v := range violations {
+			fmt.Printf("%s:%s\n", *validateXML, v.String())
+		}
+		if len(violations) > 0 {
+			fmt.Printf("\n%d violations found\n", len(violations))
+			os.Exit(1)
+		}
+		fmt.Println("Module xml is valid")
+	}
+
+	if diffCommand.Parsed() {
+		if *diffFrom == "" || *diffTo == "" || *diffJSON == "" {
+			diffCommand.PrintDefaults()
+			os.Exit(1)
+		}
+		if err := xmlParser.Diff(*diffFrom, *diffTo, *diffTranslation, *diffJSON, xmlParser.Options{
+			AllowlistFile:  *diffAllowlist,
+			ScaleTolerance: *diffScaleTolerance,
+		}); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if exportCommand.Parsed() {
+		if *exportContent == "" || *exportXML == "" {
+			exportCommand.PrintDefaults()
+			os.Exit(1)
+		}
+		cfg, err := job.LoadConfig(*exportConfig)
+		if err != nil {
 			fmt.Println(err.Error())
-			return
+			os.Exit(1)
+		}
+		if *exportHost != "" {
+			cfg.APIHost = *exportHost
+		}
+		if *exportToken != "" {
+			cfg.APIToken = *exportToken
 		}
+		exporter := &xmlParser.Exporter{
+			APIHost:      cfg.APIHost,
+			APIToken:     cfg.APIToken,
+			LanguageCode: *exportLanguage,
+		}
+		if err := exporter.Export(*exportContent, *exportXML, *exportTranslation); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	}
+}
+
+func apply(jobFile, configFile, host, token, dsn string) error {
+	j, err := job.Load(jobFile)
+	if err != nil {
+		return err
+	}
+	cfg, err := job.LoadConfig(configFile)
+	if err != nil {
+		return err
+	}
+	if host != "" {
+		cfg.APIHost = host
+	}
+	if token != "" {
+		cfg.APIToken = token
+	}
+	if dsn != "" {
+		cfg.DSN = dsn
+	}
+
+	runner, err := job.NewRunner(cfg)
+	if err != nil {
+		return err
+	}
+	defer runner.Close()
+
+	fmt.Println("Starting job apply")
+	results, err := runner.Apply(j)
+	for _, result := range results {
+		fmt.Printf("[%s] %d %s %s\n", result.Status, result.Task.Sequence, result.Task.ExecAction, result.Address)
+		if result.Err != nil {
+			fmt.Printf("  %s\n", result.Err.Error())
+		}
+	}
+	if err != nil {
+		return err
 	}
+	fmt.Println("Finished job apply")
+	return nil
 }
@@ -1,13 +1,22 @@
 package xml
 
 import (
-	"encoding/json"
 	"fmt"
+	"strconv"
 
 	"github.com/agile-work/srv-shared/constants"
 	"github.com/beevik/etree"
 )
 
+type contentPayload struct {
+	Code        string            `json:"code"`
+	Name        map[string]string `json:"name"`
+	Description map[string]string `json:"description"`
+	Prefix      string            `json:"prefix"`
+	IsModule    bool              `json:"is_module"`
+	IsSystem    bool              `json:"is_system"`
+}
+
 func createContent(x *xml, element *etree.Element, taskSequence int, path string) error {
 	elmCode := element.SelectAttrValue("code", "")
 	elmName := element.SelectAttrValue("name", "")
@@ -16,26 +25,33 @@ func createContent(x *xml, element *etree.Element, taskSequence int, path string
 	elmModule := element.SelectAttrValue("module", "false")
 	elmSystem := element.SelectAttrValue("system", "false")
 
-	path = fmt.Sprintf("%s/createContent[@code='%s']", path, elmCode)
-	if err := x.processTranslation(path, "name", &elmName); err != nil {
-		return err
+	isModule, err := strconv.ParseBool(elmModule)
+	if err != nil {
+		return fmt.Errorf("createContent %s: invalid module attribute %s", elmCode, elmModule)
 	}
-	if err := x.processTranslation(path, "description", &elmDescription); err != nil {
-		return err
+	isSystem, err := strconv.ParseBool(elmSystem)
+	if err != nil {
+		return fmt.Errorf("createContent %s: invalid system attribute %s", elmCode, elmSystem)
 	}
 
+	path = fmt.Sprintf("%s/createContent[@code='%s']", path, elmCode)
+
 	task := task{
+		Type:        "createContent",
+		Code:        elmCode,
+		Path:        path,
+		Element:     element,
 		Sequence:    taskSequence,
 		ExecAction:  constants.ExecuteAPIPost,
 		ExecAddress: "{system.api_host}/api/v1/core/admin/contents",
-		ExecPayload: (json.RawMessage)([]byte(fmt.Sprintf(`{
-			"code": "%s",
-			"name": %s,
-			"description": %s,
-			"prefix": "%s",
-			"is_module": %s,
-			"is_system": %s
-		}`, elmCode, elmName, elmDescription, elmPrefix, elmModule, elmSystem))),
+		ExecPayload: contentPayload{
+			Code:        elmCode,
+			Name:        x.processTranslation(path, "name", elmName),
+			Description: x.processTranslation(path, "description", elmDescription),
+			Prefix:      elmPrefix,
+			IsModule:    isModule,
+			IsSystem:    isSystem,
+		},
 	}
 
 	x.Tasks = append(x.Tasks, task)
@@ -45,3 +61,15 @@ func createContent(x *xml, element *etree.Element, taskSequence int, path string
 	}
 	return nil
 }
+
+func deleteContent(x *xml, element *etree.Element, taskSequence int) error {
+	elmCode := element.SelectAttrValue("code", "")
+
+	task, err := deleteTask(element, taskSequence, elmCode, fmt.Sprintf("{system.api_host}/api/v1/core/admin/contents/%s", elmCode))
+	if err != nil {
+		return err
+	}
+	x.Tasks = append(x.Tasks, task)
+	x.removeTranslations(fmt.Sprintf("createContent[@code='%s']", elmCode))
+	return nil
+}
@@ -1,24 +1,108 @@
 package xml
 
 import (
+	"encoding/json"
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/agile-work/srv-shared/constants"
 	"github.com/beevik/etree"
+	pg_query "github.com/pganalyze/pg_query_go"
+)
+
+// columnTypes are the postgres types accepted by createColumn, any of them may be used as an array with []
+var columnTypes = []string{"jsonb", "text", "numeric", "timestamptz", "boolean", "uuid"}
+
+// indexMethods are the index access methods accepted by createIndex
+var indexMethods = []string{"btree", "gin", "gist"}
+
+// expressionFunctions are the functions a createIndex where or a createConstraint check expression may call,
+// optionally qualified by pg_catalog. Operators, casts, coalesce, nullif, greatest, least and current_date
+// are not function calls and are always accepted, postgres still rejects functions that are not immutable
+// such as now() in an index predicate when the task runs
+var expressionFunctions = []string{
+	"lower", "upper", "length", "char_length", "btrim", "ltrim", "rtrim", "concat", "substr", "substring",
+	"replace", "position", "split_part", "abs", "round", "floor", "ceil", "trunc", "now", "date_trunc",
+	"date_part", "age", "array_length", "cardinality", "jsonb_typeof", "jsonb_array_length",
+}
+
+// Constraint types accepted by createConstraint
+const (
+	constraintUnique     = "unique"
+	constraintCheck      = "check"
+	constraintForeignKey = "foreignKey"
+)
+
+// referentialActions maps the onDelete values of a foreign key to their sql
+var referentialActions = map[string]string{
+	"noAction":   "NO ACTION",
+	"restrict":   "RESTRICT",
+	"cascade":    "CASCADE",
+	"setNull":    "SET NULL",
+	"setDefault": "SET DEFAULT",
+}
+
+var (
+	identifierPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+	uuidPattern       = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
 )
 
 func createColumn(x *xml, element *etree.Element, taskSequence int, path string) error {
 	elmTable := element.SelectAttrValue("table", "")
 	elmType := element.SelectAttrValue("type", "")
 	elmCode := element.SelectAttrValue("code", "")
+	elmNullable := element.SelectAttrValue("nullable", "true")
+	elmIfNotExists := element.SelectAttrValue("ifNotExists", "false")
 
 	path = fmt.Sprintf("%s/createColumn[@table='%s'][@code='%s']", path, elmTable, elmCode)
 
+	table, err := quoteTable(elmTable)
+	if err != nil {
+		return fmt.Errorf("createColumn %s.%s: %s", elmTable, elmCode, err.Error())
+	}
+	column, err := quoteIdentifier(elmCode)
+	if err != nil {
+		return fmt.Errorf("createColumn %s.%s: %s", elmTable, elmCode, err.Error())
+	}
+	if !validColumnType(elmType) {
+		return fmt.Errorf("createColumn %s.%s: invalid type %s", elmTable, elmCode, elmType)
+	}
+	nullable, err := strconv.ParseBool(elmNullable)
+	if err != nil {
+		return fmt.Errorf("createColumn %s.%s: invalid nullable attribute %s", elmTable, elmCode, elmNullable)
+	}
+	ifNotExists, err := strconv.ParseBool(elmIfNotExists)
+	if err != nil {
+		return fmt.Errorf("createColumn %s.%s: invalid ifNotExists attribute %s", elmTable, elmCode, elmIfNotExists)
+	}
+
+	query := "ALTER TABLE " + table + " ADD COLUMN "
+	if ifNotExists {
+		query += "IF NOT EXISTS "
+	}
+	query += column + " " + elmType
+	if !nullable {
+		query += " NOT NULL"
+	}
+	if elmDefault := element.SelectAttr("default"); elmDefault != nil {
+		literal, err := columnDefault(elmDefault.Value, elmType)
+		if err != nil {
+			return fmt.Errorf("createColumn %s.%s: %s", elmTable, elmCode, err.Error())
+		}
+		query += " DEFAULT " + literal
+	}
+
 	task := task{
+		Type:        "createColumn",
+		Code:        elmTable + "." + elmCode,
+		Path:        path,
+		Element:     element,
 		Sequence:    taskSequence,
 		ExecAction:  constants.ExecuteQuery,
 		ExecAddress: "local",
-		ExecPayload: fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, elmTable, elmCode, elmType),
+		ExecPayload: query,
 	}
 
 	x.Tasks = append(x.Tasks, task)
@@ -28,3 +112,334 @@ func createColumn(x *xml, element *etree.Element, taskSequence int, path string)
 	}
 	return nil
 }
+
+func dropColumn(x *xml, element *etree.Element, taskSequence int) error {
+	elmTable := element.SelectAttrValue("table", "")
+	elmCode := element.SelectAttrValue("code", "")
+	elmIfExists := element.SelectAttrValue("ifExists", "false")
+
+	table, err := quoteTable(elmTable)
+	if err != nil {
+		return fmt.Errorf("dropColumn %s.%s: %s", elmTable, elmCode, err.Error())
+	}
+	column, err := quoteIdentifier(elmCode)
+	if err != nil {
+		return fmt.Errorf("dropColumn %s.%s: %s", elmTable, elmCode, err.Error())
+	}
+	ifExists, err := strconv.ParseBool(elmIfExists)
+	if err != nil {
+		return fmt.Errorf("dropColumn %s.%s: invalid ifExists attribute %s", elmTable, elmCode, elmIfExists)
+	}
+	query := "ALTER TABLE " + table + " DROP COLUMN " + column
+	if ifExists {
+		query = "ALTER TABLE " + table + " DROP COLUMN IF EXISTS " + column
+	}
+
+	task := task{
+		Type:        "dropColumn",
+		Code:        elmTable + "." + elmCode,
+		Sequence:    taskSequence,
+		ExecAction:  constants.ExecuteQuery,
+		ExecAddress: "local",
+		ExecPayload: query,
+		IfExists:    ifExists,
+	}
+
+	x.Tasks = append(x.Tasks, task)
+	return nil
+}
+
+func createIndex(x *xml, element *etree.Element, taskSequence int, path string) error {
+	elmTable := element.SelectAttrValue("table", "")
+	elmCode := element.SelectAttrValue("code", "")
+	elmColumns := element.SelectAttrValue("columns", "")
+	elmMethod := element.SelectAttrValue("method", "btree")
+	elmUnique := element.SelectAttrValue("unique", "false")
+	elmConcurrently := element.SelectAttrValue("concurrently", "false")
+	elmIfNotExists := element.SelectAttrValue("ifNotExists", "false")
+
+	path = fmt.Sprintf("%s/createIndex[@table='%s'][@code='%s']", path, elmTable, elmCode)
+
+	table, err := quoteTable(elmTable)
+	if err != nil {
+		return fmt.Errorf("createIndex %s: %s", elmCode, err.Error())
+	}
+	index, err := quoteIdentifier(elmCode)
+	if err != nil {
+		return fmt.Errorf("createIndex %s: %s", elmCode, err.Error())
+	}
+	columns, err := quoteColumns(elmColumns)
+	if err != nil {
+		return fmt.Errorf("createIndex %s: %s", elmCode, err.Error())
+	}
+	if !contains(indexMethods, elmMethod) {
+		return fmt.Errorf("createIndex %s: invalid method %s", elmCode, elmMethod)
+	}
+	unique, err := strconv.ParseBool(elmUnique)
+	if err != nil {
+		return fmt.Errorf("createIndex %s: invalid unique attribute %s", elmCode, elmUnique)
+	}
+	concurrently, err := strconv.ParseBool(elmConcurrently)
+	if err != nil {
+		return fmt.Errorf("createIndex %s: invalid concurrently attribute %s", elmCode, elmConcurrently)
+	}
+	ifNotExists, err := strconv.ParseBool(elmIfNotExists)
+	if err != nil {
+		return fmt.Errorf("createIndex %s: invalid ifNotExists attribute %s", elmCode, elmIfNotExists)
+	}
+
+	query := "CREATE "
+	if unique {
+		query += "UNIQUE "
+	}
+	query += "INDEX "
+	if concurrently {
+		query += "CONCURRENTLY "
+	}
+	if ifNotExists {
+		query += "IF NOT EXISTS "
+	}
+	query += index + " ON " + table + " USING " + elmMethod + " (" + columns + ")"
+	if elmWhere := element.SelectAttr("where"); elmWhere != nil {
+		if err := validateExpression(elmWhere.Value); err != nil {
+			return fmt.Errorf("createIndex %s: where %s", elmCode, err.Error())
+		}
+		query += " WHERE (" + elmWhere.Value + ")"
+	}
+
+	task := task{
+		Type:        "createIndex",
+		Code:        elmCode,
+		Path:        path,
+		Element:     element,
+		Sequence:    taskSequence,
+		ExecAction:  constants.ExecuteQuery,
+		ExecAddress: "local",
+		ExecPayload: query,
+	}
+
+	x.Tasks = append(x.Tasks, task)
+	return nil
+}
+
+func createConstraint(x *xml, element *etree.Element, taskSequence int, path string) error {
+	elmTable := element.SelectAttrValue("table", "")
+	elmCode := element.SelectAttrValue("code", "")
+	elmType := element.SelectAttrValue("type", "")
+
+	path = fmt.Sprintf("%s/createConstraint[@table='%s'][@code='%s']", path, elmTable, elmCode)
+
+	table, err := quoteTable(elmTable)
+	if err != nil {
+		return fmt.Errorf("createConstraint %s.%s: %s", elmTable, elmCode, err.Error())
+	}
+	constraint, err := quoteIdentifier(elmCode)
+	if err != nil {
+		return fmt.Errorf("createConstraint %s.%s: %s", elmTable, elmCode, err.Error())
+	}
+
+	definition := ""
+	switch elmType {
+	case constraintUnique:
+		columns, err := quoteColumns(element.SelectAttrValue("columns", ""))
+		if err != nil {
+			return fmt.Errorf("createConstraint %s.%s: %s", elmTable, elmCode, err.Error())
+		}
+		definition = "UNIQUE (" + columns + ")"
+	case constraintCheck:
+		elmExpression := element.SelectAttrValue("expression", "")
+		if err := validateExpression(elmExpression); err != nil {
+			return fmt.Errorf("createConstraint %s.%s: expression %s", elmTable, elmCode, err.Error())
+		}
+		definition = "CHECK (" + elmExpression + ")"
+	case constraintForeignKey:
+		columns, err := quoteColumns(element.SelectAttrValue("columns", ""))
+		if err != nil {
+			return fmt.Errorf("createConstraint %s.%s: %s", elmTable, elmCode, err.Error())
+		}
+		referencesTable, err := quoteTable(element.SelectAttrValue("referencesTable", ""))
+		if err != nil {
+			return fmt.Errorf("createConstraint %s.%s: %s", elmTable, elmCode, err.Error())
+		}
+		referencesColumns, err := quoteColumns(element.SelectAttrValue("referencesColumns", ""))
+		if err != nil {
+			return fmt.Errorf("createConstraint %s.%s: %s", elmTable, elmCode, err.Error())
+		}
+		definition = "FOREIGN KEY (" + columns + ") REFERENCES " + referencesTable + " (" + referencesColumns + ")"
+		if elmOnDelete := element.SelectAttrValue("onDelete", ""); elmOnDelete != "" {
+			action, ok := referentialActions[elmOnDelete]
+			if !ok {
+				return fmt.Errorf("createConstraint %s.%s: invalid onDelete attribute %s", elmTable, elmCode, elmOnDelete)
+			}
+			definition += " ON DELETE " + action
+		}
+	default:
+		return fmt.Errorf("createConstraint %s.%s: invalid type %s", elmTable, elmCode, elmType)
+	}
+
+	task := task{
+		Type:        "createConstraint",
+		Code:        elmTable + "." + elmCode,
+		Path:        path,
+		Element:     element,
+		Sequence:    taskSequence,
+		ExecAction:  constants.ExecuteQuery,
+		ExecAddress: "local",
+		ExecPayload: "ALTER TABLE " + table + " ADD CONSTRAINT " + constraint + " " + definition,
+	}
+
+	x.Tasks = append(x.Tasks, task)
+	return nil
+}
+
+// quoteIdentifier returns a double quoted postgres identifier, only lower case names are accepted
+func quoteIdentifier(name string) (string, error) {
+	if !identifierPattern.MatchString(name) || len(name) > 63 {
+		return "", fmt.Errorf("invalid identifier %q", name)
+	}
+	return `"` + name + `"`, nil
+}
+
+// quoteTable quotes a table name optionally qualified by its schema
+func quoteTable(name string) (string, error) {
+	parts := strings.Split(name, ".")
+	if len(parts) > 2 {
+		return "", fmt.Errorf("invalid table %q", name)
+	}
+	quoted := []string{}
+	for _, part := range parts {
+		identifier, err := quoteIdentifier(part)
+		if err != nil {
+			return "", err
+		}
+		quoted = append(quoted, identifier)
+	}
+	return strings.Join(quoted, "."), nil
+}
+
+// quoteColumns quotes a comma separated list of column names
+func quoteColumns(names string) (string, error) {
+	quoted := []string{}
+	for _, name := range splitColumns(names) {
+		identifier, err := quoteIdentifier(name)
+		if err != nil {
+			return "", err
+		}
+		quoted = append(quoted, identifier)
+	}
+	if len(quoted) == 0 {
+		return "", fmt.Errorf("at least one column is required")
+	}
+	return strings.Join(quoted, ", "), nil
+}
+
+func splitColumns(names string) []string {
+	columns := []string{}
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			columns = append(columns, name)
+		}
+	}
+	return columns
+}
+
+// validateExpression parses a sql boolean expression and rejects anything else than a single expression
+// over the row, subqueries, params and functions outside expressionFunctions
+func validateExpression(expression string) error {
+	if strings.TrimSpace(expression) == "" {
+		return fmt.Errorf("must not be empty")
+	}
+	// the expression is parsed enclosed in parentheses as the index and constraint sql embed it,
+	// so a trailing comment hiding the closing parenthesis is a syntax error
+	tree, err := pg_query.ParseToJSON("SELECT 1 WHERE (" + expression + ")")
+	if err != nil {
+		return fmt.Errorf("invalid sql: %s", err.Error())
+	}
+	statements := []struct {
+		RawStmt struct {
+			Stmt map[string]map[string]interface{} `json:"stmt"`
+		}
+	}{}
+	if err := json.Unmarshal([]byte(tree), &statements); err != nil {
+		return err
+	}
+	if len(statements) != 1 {
+		return fmt.Errorf("must be a single expression")
+	}
+	selectStmt, ok := statements[0].RawStmt.Stmt["SelectStmt"]
+	if !ok {
+		return fmt.Errorf("must be a single expression")
+	}
+	for key, value := range selectStmt {
+		if (key != "targetList" && key != "whereClause" && key != "op") || (key == "op" && value != float64(0)) {
+			return fmt.Errorf("must be a single expression")
+		}
+	}
+
+	return walkSQL(selectStmt["whereClause"], func(nodeType string, fields map[string]interface{}) error {
+		switch nodeType {
+		case "SubLink", "SelectStmt", "RangeVar":
+			return fmt.Errorf("must not use subqueries")
+		case "ParamRef":
+			return fmt.Errorf("must not use params")
+		case "FuncCall":
+			name := strings.TrimPrefix(sqlFunctionName(fields), "pg_catalog.")
+			if !contains(expressionFunctions, name) {
+				return fmt.Errorf("must not call function %s, expected one of %s", name, strings.Join(expressionFunctions, ", "))
+			}
+		}
+		return nil
+	})
+}
+
+func validColumnType(columnType string) bool {
+	return contains(columnTypes, strings.TrimSuffix(columnType, "[]"))
+}
+
+// columnDefault validates a default value against the column type and returns it as a sql literal
+func columnDefault(value, columnType string) (string, error) {
+	if itemType := strings.TrimSuffix(columnType, "[]"); itemType != columnType {
+		items := []string{}
+		if err := json.Unmarshal([]byte(value), &items); err != nil {
+			return "", fmt.Errorf("default of an array column must be a json list of strings, found %q", value)
+		}
+		literals := []string{}
+		for _, item := range items {
+			if err := validateDefault(item, itemType); err != nil {
+				return "", err
+			}
+			literals = append(literals, quoteLiteral(item))
+		}
+		return "ARRAY[" + strings.Join(literals, ", ") + "]::" + columnType, nil
+	}
+	if err := validateDefault(value, columnType); err != nil {
+		return "", err
+	}
+	return quoteLiteral(value) + "::" + columnType, nil
+}
+
+func validateDefault(value, columnType string) error {
+	switch columnType {
+	case "numeric":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("invalid numeric default %q", value)
+		}
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("invalid boolean default %q", value)
+		}
+	case "jsonb":
+		if !json.Valid([]byte(value)) {
+			return fmt.Errorf("invalid jsonb default %q", value)
+		}
+	case "uuid":
+		if !uuidPattern.MatchString(value) {
+			return fmt.Errorf("invalid uuid default %q", value)
+		}
+	}
+	return nil
+}
+
+func quoteLiteral(value string) string {
+	return "'" + strings.Replace(value, "'", "''", -1) + "'"
+}
@@ -0,0 +1,144 @@
+package xml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQuoteIdentifier(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		err      string
+	}{
+		{name: "title", expected: `"title"`},
+		{name: "_sys_order2", expected: `"_sys_order2"`},
+		{name: "select", expected: `"select"`},
+		{name: "user", expected: `"user"`},
+		{name: `ti"tle`, err: `invalid identifier "ti\"tle"`},
+		{name: `title"; drop table core_users; --`, err: "invalid identifier"},
+		{name: "Title", err: `invalid identifier "Title"`},
+		{name: "2title", err: `invalid identifier "2title"`},
+		{name: "", err: `invalid identifier ""`},
+		{name: strings.Repeat("a", 64), err: "invalid identifier"},
+	}
+	for _, test := range tests {
+		quoted, err := quoteIdentifier(test.name)
+		checkQuoted(t, test.name, quoted, err, test.expected, test.err)
+	}
+}
+
+func TestQuoteTable(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		err      string
+	}{
+		{name: "sys_mdl_tst_tasks", expected: `"sys_mdl_tst_tasks"`},
+		{name: "public.sys_mdl_tst_tasks", expected: `"public"."sys_mdl_tst_tasks"`},
+		{name: "order", expected: `"order"`},
+		{name: "public.order", expected: `"public"."order"`},
+		{name: "db.public.tasks", err: `invalid table "db.public.tasks"`},
+		{name: "public.", err: `invalid identifier ""`},
+		{name: `public."tasks"`, err: `invalid identifier "\"tasks\""`},
+		{name: `tasks" cascade`, err: "invalid identifier"},
+	}
+	for _, test := range tests {
+		quoted, err := quoteTable(test.name)
+		checkQuoted(t, test.name, quoted, err, test.expected, test.err)
+	}
+}
+
+func TestQuoteColumns(t *testing.T) {
+	tests := []struct {
+		names    string
+		expected string
+		err      string
+	}{
+		{names: "title", expected: `"title"`},
+		{names: "title, order ,group", expected: `"title", "order", "group"`},
+		{names: "title,,status", expected: `"title", "status"`},
+		{names: "title, st\"atus", err: `invalid identifier "st\"atus"`},
+		{names: "lower(title)", err: `invalid identifier "lower(title)"`},
+		{names: " , ", err: "at least one column is required"},
+	}
+	for _, test := range tests {
+		quoted, err := quoteColumns(test.names)
+		checkQuoted(t, test.names, quoted, err, test.expected, test.err)
+	}
+}
+
+// checkQuoted expects either the quoted name or an error containing expectedErr
+func checkQuoted(t *testing.T, name, quoted string, err error, expected, expectedErr string) {
+	t.Helper()
+	if expectedErr != "" {
+		if err == nil || !strings.Contains(err.Error(), expectedErr) {
+			t.Errorf("%q: expected error %s, found %q %v", name, expectedErr, quoted, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Errorf("%q: unexpected error %s", name, err.Error())
+	} else if quoted != expected {
+		t.Errorf("%q: expected %s, found %s", name, expected, quoted)
+	}
+}
+
+func TestValidateExpression(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		err        string
+	}{
+		{name: "comparison", expression: "status <> 'closed' and effort > 0"},
+		{name: "allowed functions", expression: "lower(title) like 'a%' and created_at < now()"},
+		{name: "qualified function", expression: "pg_catalog.length(title) > 3"},
+		{name: "coalesce and nullif", expression: "coalesce(effort, 0) >= 0 and nullif(title, '') is not null"},
+		{name: "cast and list", expression: "status::text in ('open', 'closed')"},
+		{name: "block comment", expression: "effort /* hours */ > 0"},
+		{name: "empty", expression: "  ", err: "must not be empty"},
+		{name: "subquery", expression: "owner in (select username from core_users)", err: "must not use subqueries"},
+		{name: "exists", expression: "exists (select 1 from core_users)", err: "must not use subqueries"},
+		{name: "param", expression: "effort > $1", err: "must not use params"},
+		{name: "unlisted function", expression: "pg_sleep(1) is null", err: "must not call function pg_sleep, expected one of lower"},
+		{name: "line comment", expression: "effort > 0 -- hidden", err: "invalid sql"},
+		{name: "second statement", expression: "true); drop table core_users; select (1", err: "must be a single expression"},
+		{name: "trailing semicolon", expression: "effort > 0;", err: "invalid sql"},
+		{name: "union", expression: "true) union select (1", err: "must be a single expression"},
+		{name: "order by", expression: "true) order by (1", err: "must be a single expression"},
+		{name: "invalid sql", expression: "effort >", err: "invalid sql"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateExpression(test.expression)
+			if test.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error %s", err.Error())
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("expected error %s, found %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestCreateIndexWhere(t *testing.T) {
+	module := testModule(`<task:createColumn table="sys_mdl_tst_tasks" type="timestamptz" code="closed_at" />
+      <task:createIndex table="sys_mdl_tst_tasks" code="open_idx" columns="closed_at" where="closed_at is null or closed_at > now()" />
+      <task:createIndex table="sys_mdl_tst_tasks" code="slow_idx" columns="closed_at" where="pg_sleep(1) is null" />`)
+	checkViolations(t, module, Options{}, []expectedViolation{
+		{7, "task:createIndex: where must not call function pg_sleep"},
+	})
+
+	x, err := parse(writeModule(t, testModule(`<task:createColumn table="sys_mdl_tst_tasks" type="timestamptz" code="closed_at" />
+      <task:createIndex table="sys_mdl_tst_tasks" code="open_idx" columns="closed_at" where="closed_at is null" />`)), "", Options{})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	expected := `CREATE INDEX "open_idx" ON "sys_mdl_tst_tasks" USING btree ("closed_at") WHERE (closed_at is null)`
+	if payload := findTask(t, x, "createIndex", "open_idx").ExecPayload; payload != expected {
+		t.Errorf("expected payload %s, found %v", expected, payload)
+	}
+}
@@ -1,14 +1,65 @@
 package xml
 
 import (
-	"encoding/json"
 	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/agile-work/cli/action"
 	"github.com/agile-work/srv-shared/constants"
 	"github.com/beevik/etree"
 )
 
+type datasetPayload struct {
+	Code        string            `json:"code"`
+	Name        map[string]string `json:"name"`
+	Type        string            `json:"type"`
+	Description map[string]string `json:"description"`
+	Definitions interface{}       `json:"definitions"`
+}
+
+type staticDatasetDefinitions struct {
+	Order   []string                 `json:"order"`
+	Options map[string]datasetOption `json:"options"`
+}
+
+type datasetOption struct {
+	Code   string            `json:"code"`
+	Name   map[string]string `json:"name"`
+	Active bool              `json:"active"`
+	Color  string            `json:"color,omitempty"`
+	Icon   string            `json:"icon,omitempty"`
+	Parent string            `json:"parent,omitempty"`
+}
+
+type dynamicDatasetDefinitions struct {
+	Query  string         `json:"query"`
+	Params []datasetParam `json:"params,omitempty"`
+}
+
+type datasetParam struct {
+	Code string `json:"code"`
+	Type string `json:"type"`
+}
+
+var (
+	// paramPattern matches the {{param:name:type}} placeholders of a dataset query
+	paramPattern = regexp.MustCompile(`\{\{\s*param:([^}]*)\}\}`)
+	// paramStartPattern matches the opening of a placeholder with the same spacing accepted by paramPattern
+	paramStartPattern = regexp.MustCompile(`\{\{\s*param:`)
+	colorPattern      = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+	iconPattern       = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+)
+
+type datasetUpdatePayload struct {
+	Name        map[string]string `json:"name,omitempty"`
+	Description map[string]string `json:"description,omitempty"`
+	Definitions interface{}       `json:"definitions,omitempty"`
+}
+
 func createDataset(x *xml, element *etree.Element, taskSequence int, path string) error {
 	elmCode := element.SelectAttrValue("code", "")
 	elmName := element.SelectAttrValue("name", "")
@@ -16,71 +67,36 @@ func createDataset(x *xml, element *etree.Element, taskSequence int, path string
 	elmDescription := element.SelectAttrValue("desc", "")
 
 	path = fmt.Sprintf("%s/createDataset[@code='%s']", path, elmCode)
-	if err := x.processTranslation(path, "name", &elmName); err != nil {
-		return err
-	}
-	if err := x.processTranslation(path, "description", &elmDescription); err != nil {
-		return err
+	payload := datasetPayload{
+		Code:        elmCode,
+		Name:        x.processTranslation(path, "name", elmName),
+		Type:        elmType,
+		Description: x.processTranslation(path, "description", elmDescription),
 	}
 
-	payload := fmt.Sprintf(`
-		"code": "%s",
-		"name": %s,
-		"type": "%s",
-		"description": %s
-	`, elmCode, elmName, elmType, elmDescription)
-
 	if elmType == constants.DatasetStatic {
-		elmOptions := element.SelectElement("options").SelectElements("option")
-		orders := []string{}
-		options := make(map[string]map[string]interface{})
-
-		for _, elmOption := range elmOptions {
-			option := make(map[string]interface{})
-			code := elmOption.SelectAttrValue("code", "")
-			name := elmOption.SelectAttrValue("name", "")
-			orders = append(orders, code)
-
-			pathOption := fmt.Sprintf("%s/options/option[@code='%s']", path, code)
-			if err := x.processTranslation(pathOption, "name", &name); err != nil {
-				return err
-			}
-
-			option["code"] = code
-			option["name"] = (json.RawMessage)([]byte(name))
-			option["active"] = "true"
-			options[code] = option
-		}
-		ordersByte, err := json.MarshalIndent(orders, "", "  ")
+		definitions, err := processStaticDatasetPayload(x, element, path)
 		if err != nil {
-			return err
+			return fmt.Errorf("dataset %s: %s", elmCode, err.Error())
 		}
-		optionsByte, err := json.MarshalIndent(options, "", "  ")
+		payload.Definitions = definitions
+	} else {
+		definitions, err := processDynamicDatasetPayload(element)
 		if err != nil {
-			return err
+			return fmt.Errorf("dataset %s: %s", elmCode, err.Error())
 		}
-		payload = fmt.Sprintf(`{
-			%s,
-			"definitions": {
-				"order": %s,
-				"options": %s
-			}
-		}`, payload, string(ordersByte), string(optionsByte))
-	} else {
-		elmQuery := element.SelectElement("query")
-		payload = fmt.Sprintf(`{
-			%s,
-			"definitions": {
-        "query": "%s"
-    	}
-		}`, payload, strings.Trim(elmQuery.Text(), " \n\r"))
+		payload.Definitions = definitions
 	}
 
 	task := task{
+		Type:        "createDataset",
+		Code:        elmCode,
+		Path:        path,
+		Element:     element,
 		Sequence:    taskSequence,
 		ExecAction:  constants.ExecuteAPIPost,
 		ExecAddress: "{system.api_host}/api/v1/core/admin/datasets",
-		ExecPayload: (json.RawMessage)([]byte(payload)),
+		ExecPayload: payload,
 	}
 
 	x.Tasks = append(x.Tasks, task)
@@ -90,3 +106,261 @@ func createDataset(x *xml, element *etree.Element, taskSequence int, path string
 	}
 	return nil
 }
+
+func updateDataset(x *xml, element *etree.Element, taskSequence int, path string) error {
+	elmCode := element.SelectAttrValue("code", "")
+	elmType := element.SelectAttrValue("type", "")
+
+	path = fmt.Sprintf("%s/updateDataset[@code='%s']", path, elmCode)
+	payload := datasetUpdatePayload{}
+	if elmName := element.SelectAttr("name"); elmName != nil {
+		payload.Name = x.processTranslation(path, "name", elmName.Value)
+	}
+	if elmDescription := element.SelectAttr("desc"); elmDescription != nil {
+		payload.Description = x.processTranslation(path, "description", elmDescription.Value)
+	}
+	if elmType == constants.DatasetStatic && element.SelectElement("options") != nil {
+		definitions, err := processStaticDatasetPayload(x, element, path)
+		if err != nil {
+			return fmt.Errorf("dataset %s: %s", elmCode, err.Error())
+		}
+		payload.Definitions = definitions
+	} else if elmType != constants.DatasetStatic && element.SelectElement("query") != nil {
+		definitions, err := processDynamicDatasetPayload(element)
+		if err != nil {
+			return fmt.Errorf("dataset %s: %s", elmCode, err.Error())
+		}
+		payload.Definitions = definitions
+	}
+
+	task := task{
+		Type:        "updateDataset",
+		Code:        elmCode,
+		Path:        path,
+		Element:     element,
+		Sequence:    taskSequence,
+		ExecAction:  action.ExecuteAPIPatch,
+		ExecAddress: fmt.Sprintf("{system.api_host}/api/v1/core/admin/datasets/%s", elmCode),
+		ExecPayload: payload,
+	}
+
+	x.Tasks = append(x.Tasks, task)
+
+	if err := x.processTask(element.ChildElements(), taskSequence, path); err != nil {
+		return err
+	}
+	return nil
+}
+
+func deleteDataset(x *xml, element *etree.Element, taskSequence int) error {
+	elmCode := element.SelectAttrValue("code", "")
+
+	task, err := deleteTask(element, taskSequence, elmCode, fmt.Sprintf("{system.api_host}/api/v1/core/admin/datasets/%s", elmCode))
+	if err != nil {
+		return err
+	}
+	x.Tasks = append(x.Tasks, task)
+	x.removeTranslations(
+		fmt.Sprintf("createDataset[@code='%s']", elmCode),
+		fmt.Sprintf("updateDataset[@code='%s']", elmCode),
+	)
+	return nil
+}
+
+func processStaticDatasetPayload(x *xml, element *etree.Element, path string) (staticDatasetDefinitions, error) {
+	definitions := staticDatasetDefinitions{
+		Order:   []string{},
+		Options: make(map[string]datasetOption),
+	}
+	elmOptions := element.SelectElement("options")
+	if elmOptions == nil {
+		return definitions, fmt.Errorf("static dataset requires an options element")
+	}
+
+	attrs := []map[string]string{}
+	names := []map[string]string{}
+	if src := elmOptions.SelectAttrValue("src", ""); src != "" {
+		options, err := loadOptionFile(filepath.Join(x.Dir, src), x.LanguageCode)
+		if err != nil {
+			return definitions, err
+		}
+		for _, option := range options {
+			attrs = append(attrs, option.Attrs)
+			names = append(names, option.Names)
+		}
+	} else {
+		for _, elmOption := range elmOptions.SelectElements("option") {
+			attrs = append(attrs, elementAttrs(elmOption))
+			names = append(names, map[string]string{x.LanguageCode: elmOption.SelectAttrValue("name", "")})
+		}
+	}
+	if errs := checkDatasetOptions(attrs); len(errs) > 0 {
+		return definitions, errs[0].Err
+	}
+
+	// options without order keep the order of the xml
+	orders := make(map[string]int64)
+	for i, option := range attrs {
+		code := option["code"]
+		if _, ok := definitions.Options[code]; ok {
+			return definitions, fmt.Errorf("duplicate option %s", code)
+		}
+		active := true
+		if value, ok := option["active"]; ok {
+			active, _ = strconv.ParseBool(value)
+		}
+		orders[code], _ = strconv.ParseInt(option["order"], 10, 64)
+		definitions.Order = append(definitions.Order, code)
+
+		pathOption := fmt.Sprintf("%s/options/option[@code='%s']", path, code)
+		definitions.Options[code] = datasetOption{
+			Code:   code,
+			Name:   x.processTranslations(pathOption, "name", names[i]),
+			Active: active,
+			Color:  option["color"],
+			Icon:   option["icon"],
+			Parent: option["parent"],
+		}
+	}
+	sort.SliceStable(definitions.Order, func(i, j int) bool {
+		return orders[definitions.Order[i]] < orders[definitions.Order[j]]
+	})
+	return definitions, nil
+}
+
+// optionError is a problem found in the option at Index of a static dataset
+type optionError struct {
+	Index int
+	Err   error
+}
+
+// checkDatasetOptions reports invalid or repeated orders, orders set on only some options,
+// invalid colors and icons and parents that are missing or form a cycle
+func checkDatasetOptions(options []map[string]string) []optionError {
+	errs := []optionError{}
+	codes := []string{}
+	parents := make(map[string]string)
+	orders := make(map[int64]string)
+	ordered := 0
+	for _, option := range options {
+		codes = append(codes, option["code"])
+		if parent, ok := option["parent"]; ok {
+			parents[option["code"]] = parent
+		}
+	}
+
+	for i, option := range options {
+		code := option["code"]
+		if value, ok := option["order"]; ok {
+			ordered++
+			order, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				errs = append(errs, optionError{Index: i, Err: fmt.Errorf("option %s: order %s is not an integer", code, value)})
+			} else if previous, ok := orders[order]; ok {
+				errs = append(errs, optionError{Index: i, Err: fmt.Errorf("option %s: order %d is already used by option %s", code, order, previous)})
+			} else {
+				orders[order] = code
+			}
+		}
+		if value, ok := option["active"]; ok {
+			if _, err := strconv.ParseBool(value); err != nil {
+				errs = append(errs, optionError{Index: i, Err: fmt.Errorf("option %s: active %s is not a boolean", code, value)})
+			}
+		}
+		if value, ok := option["color"]; ok && !colorPattern.MatchString(value) {
+			errs = append(errs, optionError{Index: i, Err: fmt.Errorf("option %s: invalid color %s, expected #RGB or #RRGGBB", code, value)})
+		}
+		if value, ok := option["icon"]; ok && !iconPattern.MatchString(value) {
+			errs = append(errs, optionError{Index: i, Err: fmt.Errorf("option %s: invalid icon %s", code, value)})
+		}
+		parent, ok := parents[code]
+		switch {
+		case !ok:
+		case parent == code:
+			errs = append(errs, optionError{Index: i, Err: fmt.Errorf("option %s can not be its own parent", code)})
+		case !contains(codes, parent):
+			errs = append(errs, optionError{Index: i, Err: fmt.Errorf("option %s: parent %s is not an option of the dataset", code, parent)})
+		default:
+			// an option is in a cycle when walking up its parents comes back to it
+			for steps, current := 0, parent; steps < len(options); steps++ {
+				if current == code {
+					errs = append(errs, optionError{Index: i, Err: fmt.Errorf("option %s: parent %s forms a cycle", code, parent)})
+					break
+				}
+				if current, ok = parents[current]; !ok {
+					break
+				}
+			}
+		}
+	}
+	if ordered > 0 && ordered < len(options) {
+		for i, option := range options {
+			if _, ok := option["order"]; !ok {
+				errs = append(errs, optionError{Index: i, Err: fmt.Errorf("option %s: order is required when other options set it", option["code"])})
+			}
+		}
+	}
+	return errs
+}
+
+func processDynamicDatasetPayload(element *etree.Element) (dynamicDatasetDefinitions, error) {
+	elmQuery := element.SelectElement("query")
+	definitions := dynamicDatasetDefinitions{
+		Query: strings.Trim(elmQuery.Text(), " \n\r"),
+	}
+	params, err := parseQueryParams(definitions.Query)
+	if err != nil {
+		return definitions, err
+	}
+	definitions.Params = params
+	if _, _, err := queryColumns(definitions.Query); err != nil {
+		return definitions, err
+	}
+	return definitions, nil
+}
+
+// parseQueryParams returns the params of the {{param:name:type}} placeholders in order of appearance
+func parseQueryParams(query string) ([]datasetParam, error) {
+	params := []datasetParam{}
+	types := make(map[string]string)
+	matches := paramPattern.FindAllStringSubmatch(query, -1)
+	if len(paramStartPattern.FindAllStringIndex(query, -1)) != len(matches) {
+		return nil, fmt.Errorf("query has an unterminated param placeholder")
+	}
+	for _, match := range matches {
+		parts := strings.Split(strings.TrimSpace(match[1]), ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid placeholder %s, expected {{param:name:type}}", match[0])
+		}
+		code, paramType := parts[0], parts[1]
+		if !identifierPattern.MatchString(code) {
+			return nil, fmt.Errorf("invalid param name %s in %s", code, match[0])
+		}
+		if !contains(valueTypes, paramType) || paramType == valueNull {
+			return nil, fmt.Errorf("invalid param type %s in %s", paramType, match[0])
+		}
+		if previous, ok := types[code]; ok {
+			if previous != paramType {
+				return nil, fmt.Errorf("param %s is used as %s and %s", code, previous, paramType)
+			}
+			continue
+		}
+		types[code] = paramType
+		params = append(params, datasetParam{Code: code, Type: paramType})
+	}
+	return params, nil
+}
+
+// compatibleValueType reports if a lookup param of a value type may be bound to a query param of a type
+func compatibleValueType(paramType, valueType string) bool {
+	if valueType == "" {
+		valueType = valueString
+	}
+	switch {
+	case paramType == valueType, valueType == valueNull:
+		return true
+	case paramType == valueDecimal || paramType == valueNumber:
+		return valueType == valueInteger || valueType == valueDecimal || valueType == valueNumber
+	}
+	return false
+}
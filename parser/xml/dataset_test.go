@@ -0,0 +1,150 @@
+package xml
+
+import (
+	"strings"
+	"testing"
+)
+
+// staticDataset returns a static dataset of the test module with the given option elements
+func staticDataset(options ...string) string {
+	return `<task:createDataset type="static" code="ds_tst_status" name="Status">
+        <options>
+          ` + strings.Join(options, "\n          ") + `
+        </options>
+      </task:createDataset>`
+}
+
+func TestValidateStaticOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  []string
+		expected []expectedViolation
+	}{
+		{
+			name: "valid options",
+			options: []string{
+				`<option code="open" name="Open" order="2" color="#0a0" icon="circle-open" />`,
+				`<option code="closed" name="Closed" order="1" color="#00AA00" active="false" />`,
+				`<option code="reopened" name="Reopened" order="3" parent="open" />`,
+			},
+		},
+		{
+			name:     "invalid active",
+			options:  []string{`<option code="open" name="Open" active="yes" />`},
+			expected: []expectedViolation{{7, "option: option open: active yes is not a boolean"}},
+		},
+		{
+			name:     "invalid color",
+			options:  []string{`<option code="open" name="Open" color="green" />`},
+			expected: []expectedViolation{{7, "option: option open: invalid color green, expected #RGB or #RRGGBB"}},
+		},
+		{
+			name:     "invalid icon",
+			options:  []string{`<option code="open" name="Open" icon="Circle Open" />`},
+			expected: []expectedViolation{{7, "option: option open: invalid icon Circle Open"}},
+		},
+		{
+			name:     "invalid order",
+			options:  []string{`<option code="open" name="Open" order="first" />`},
+			expected: []expectedViolation{{7, "option: option open: order first is not an integer"}},
+		},
+		{
+			name: "repeated order",
+			options: []string{
+				`<option code="open" name="Open" order="1" />`,
+				`<option code="closed" name="Closed" order="1" />`,
+			},
+			expected: []expectedViolation{{8, "option: option closed: order 1 is already used by option open"}},
+		},
+		{
+			name: "order set on some options",
+			options: []string{
+				`<option code="open" name="Open" order="1" />`,
+				`<option code="closed" name="Closed" />`,
+			},
+			expected: []expectedViolation{{8, "option: option closed: order is required when other options set it"}},
+		},
+		{
+			name: "duplicate code",
+			options: []string{
+				`<option code="open" name="Open" />`,
+				`<option code="open" name="Opened" />`,
+			},
+			expected: []expectedViolation{{8, "option: duplicate option open"}},
+		},
+		{
+			name:     "own parent",
+			options:  []string{`<option code="open" name="Open" parent="open" />`},
+			expected: []expectedViolation{{7, "option: option open can not be its own parent"}},
+		},
+		{
+			name:     "dangling parent",
+			options:  []string{`<option code="open" name="Open" parent="draft" />`},
+			expected: []expectedViolation{{7, "option: option open: parent draft is not an option of the dataset"}},
+		},
+		{
+			name: "parent cycle",
+			options: []string{
+				`<option code="open" name="Open" parent="closed" />`,
+				`<option code="closed" name="Closed" parent="reopened" />`,
+				`<option code="reopened" name="Reopened" parent="open" />`,
+			},
+			expected: []expectedViolation{
+				{7, "option open: parent closed forms a cycle"},
+				{8, "option closed: parent reopened forms a cycle"},
+				{9, "option reopened: parent open forms a cycle"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkViolations(t, testModule(staticDataset(test.options...)), Options{}, test.expected)
+		})
+	}
+}
+
+func TestStaticDatasetPayload(t *testing.T) {
+	x, err := parse(writeModule(t, testModule(staticDataset(
+		`<option code="open" name="Open" order="2" color="#0a0" icon="circle-open" />`,
+		`<option code="closed" name="Closed" order="10" active="false" />`,
+		`<option code="draft" name="Draft" order="-1" />`,
+		`<option code="reopened" name="Reopened" order="3" parent="open" />`,
+	))), "", Options{})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	definitions := findTask(t, x, "createDataset", "ds_tst_status").ExecPayload.(datasetPayload).Definitions.(staticDatasetDefinitions)
+	if order := strings.Join(definitions.Order, ","); order != "draft,open,reopened,closed" {
+		t.Errorf("expected the options sorted by order, found %s", order)
+	}
+	tests := []struct {
+		code     string
+		expected datasetOption
+	}{
+		{code: "open", expected: datasetOption{Code: "open", Active: true, Color: "#0a0", Icon: "circle-open"}},
+		{code: "closed", expected: datasetOption{Code: "closed", Active: false}},
+		{code: "reopened", expected: datasetOption{Code: "reopened", Active: true, Parent: "open"}},
+	}
+	for _, test := range tests {
+		option := definitions.Options[test.code]
+		if option.Code != test.expected.Code || option.Active != test.expected.Active || option.Color != test.expected.Color ||
+			option.Icon != test.expected.Icon || option.Parent != test.expected.Parent {
+			t.Errorf("expected option %+v, found %+v", test.expected, option)
+		}
+	}
+}
+
+func TestStaticDatasetPayloadKeepsTheModuleOrder(t *testing.T) {
+	x, err := parse(writeModule(t, testModule(staticDataset(
+		`<option code="open" name="Open" />`,
+		`<option code="closed" name="Closed" />`,
+		`<option code="draft" name="Draft" />`,
+	))), "", Options{})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	definitions := findTask(t, x, "createDataset", "ds_tst_status").ExecPayload.(datasetPayload).Definitions.(staticDatasetDefinitions)
+	if order := strings.Join(definitions.Order, ","); order != "open,closed,draft" {
+		t.Errorf("expected the options in the module order, found %s", order)
+	}
+}
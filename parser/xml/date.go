@@ -0,0 +1,148 @@
+package xml
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Display modes of a date field
+const (
+	dateDisplayDate     = "date"
+	dateDisplayTime     = "time"
+	dateDisplayDateTime = "date_time"
+)
+
+var dateDisplays = []string{dateDisplayDate, dateDisplayTime, dateDisplayDateTime}
+
+// Timezone policies of a date field besides a fixed zone
+const (
+	timezoneUser = "user"
+	timezoneUTC  = "utc"
+)
+
+var offsetPattern = regexp.MustCompile(`^[+-](0[0-9]|1[0-4]):[0-5][0-9]$`)
+
+// dateToken is a placeholder of a date format, MM is always the month and mm the minutes
+type dateToken struct {
+	Token string
+	Part  string
+	Time  bool
+}
+
+// dateTokens are matched longest first so YYYY is not read as two YY
+var dateTokens = []dateToken{
+	{Token: "YYYY", Part: "year"},
+	{Token: "YY", Part: "year"},
+	{Token: "MM", Part: "month"},
+	{Token: "DD", Part: "day"},
+	{Token: "HH", Part: "hour", Time: true},
+	{Token: "hh", Part: "hour", Time: true},
+	{Token: "mm", Part: "minute", Time: true},
+	{Token: "ss", Part: "second", Time: true},
+	{Token: "A", Part: "meridiem", Time: true},
+}
+
+const dateSeparators = "/-.:, T"
+
+// defaultDateFormats holds the date and time formats used by each language when a field does not set one
+var defaultDateFormats = map[string][2]string{
+	"en-us": {"MM/DD/YYYY", "hh:mm A"},
+	"en-gb": {"DD/MM/YYYY", "HH:mm"},
+	"pt-br": {"DD/MM/YYYY", "HH:mm"},
+	"es-es": {"DD/MM/YYYY", "HH:mm"},
+	"fr-fr": {"DD/MM/YYYY", "HH:mm"},
+	"de-de": {"DD.MM.YYYY", "HH:mm"},
+}
+
+// defaultDateFormat returns the format of a display mode for a language, unknown languages use ISO 8601
+func defaultDateFormat(languageCode, display string) string {
+	formats, ok := defaultDateFormats[strings.ToLower(languageCode)]
+	if !ok {
+		formats = [2]string{"YYYY-MM-DD", "HH:mm"}
+	}
+	switch display {
+	case dateDisplayDate:
+		return formats[0]
+	case dateDisplayTime:
+		return formats[1]
+	}
+	return formats[0] + " " + formats[1]
+}
+
+// parseDateFormat checks a format against the grammar and the parts required by the display mode
+func parseDateFormat(format, display string) error {
+	parts := make(map[string]string)
+	hasDate, hasTime := false, false
+	for i := 0; i < len(format); {
+		if strings.IndexByte(dateSeparators, format[i]) >= 0 {
+			i++
+			continue
+		}
+		var token *dateToken
+		for j := range dateTokens {
+			if strings.HasPrefix(format[i:], dateTokens[j].Token) {
+				token = &dateTokens[j]
+				break
+			}
+		}
+		if token == nil {
+			return fmt.Errorf("invalid format %s, unexpected %q at position %d", format, format[i], i+1)
+		}
+		if previous, ok := parts[token.Part]; ok {
+			if token.Part == "month" {
+				return fmt.Errorf("invalid format %s, month %s is repeated, use mm for minutes", format, previous)
+			}
+			return fmt.Errorf("invalid format %s, %s is repeated", format, token.Part)
+		}
+		parts[token.Part] = token.Token
+		hasDate = hasDate || !token.Time
+		hasTime = hasTime || token.Time
+		i += len(token.Token)
+	}
+
+	switch {
+	case parts["hour"] == "hh" && parts["meridiem"] == "":
+		return fmt.Errorf("invalid format %s, hh requires A", format)
+	case parts["meridiem"] != "" && parts["hour"] != "hh":
+		return fmt.Errorf("invalid format %s, A requires hh", format)
+	case parts["minute"] != "" && parts["hour"] == "":
+		return fmt.Errorf("invalid format %s, mm requires an hour", format)
+	case parts["second"] != "" && parts["minute"] == "":
+		return fmt.Errorf("invalid format %s, ss requires mm", format)
+	case hasDate && (parts["year"] == "" || parts["month"] == "" || parts["day"] == ""):
+		return fmt.Errorf("invalid format %s, a date requires year, month and day", format)
+	}
+
+	switch display {
+	case dateDisplayDate:
+		if !hasDate || hasTime {
+			return fmt.Errorf("format %s of a date display must only have date parts", format)
+		}
+	case dateDisplayTime:
+		if hasDate || !hasTime {
+			return fmt.Errorf("format %s of a time display must only have time parts", format)
+		}
+	case dateDisplayDateTime:
+		if !hasDate || !hasTime {
+			return fmt.Errorf("format %s of a date_time display must have date and time parts", format)
+		}
+	default:
+		return fmt.Errorf("invalid display %s, expected one of %s", display, strings.Join(dateDisplays, ", "))
+	}
+	return nil
+}
+
+// parseTimezone accepts the user and utc policies, an IANA zone name or a fixed offset such as -03:00
+func parseTimezone(timezone string) error {
+	if timezone == timezoneUser || timezone == timezoneUTC || offsetPattern.MatchString(timezone) {
+		return nil
+	}
+	if strings.Contains(timezone, "/") {
+		if _, err := time.LoadLocation(timezone); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid timezone %s, expected user, utc, a zone name or an offset as +HH:MM", timezone)
+}
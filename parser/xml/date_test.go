@@ -0,0 +1,151 @@
+package xml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDateFormat(t *testing.T) {
+	tests := []struct {
+		format  string
+		display string
+		err     string
+	}{
+		{format: "YYYY-MM-DD", display: "date"},
+		{format: "DD/MM/YY", display: "date"},
+		{format: "DD.MM.YYYY", display: "date"},
+		{format: "HH:mm", display: "time"},
+		{format: "hh:mm:ss A", display: "time"},
+		{format: "YYYY-MM-DDTHH:mm:ss", display: "date_time"},
+		{format: "MM/DD/YYYY, hh:mm A", display: "date_time"},
+		{format: "YYYY-MM-DD", display: "week", err: "invalid display week, expected one of date, time, date_time"},
+		{format: "YYYY-MM-DD Q", display: "date", err: "invalid format YYYY-MM-DD Q, unexpected 'Q' at position 12"},
+		{format: "YYYY-mm-DD", display: "date", err: "invalid format YYYY-mm-DD, mm requires an hour"},
+		{format: "HH:MM", display: "time", err: "invalid format HH:MM, a date requires year, month and day"},
+		{format: "DD/MM/YYYY HH:MM", display: "date_time", err: "invalid format DD/MM/YYYY HH:MM, month MM is repeated, use mm for minutes"},
+		{format: "YYYY-YY-MM-DD", display: "date", err: "invalid format YYYY-YY-MM-DD, year is repeated"},
+		{format: "hh:mm", display: "time", err: "invalid format hh:mm, hh requires A"},
+		{format: "HH:mm A", display: "time", err: "invalid format HH:mm A, A requires hh"},
+		{format: "HH:ss", display: "time", err: "invalid format HH:ss, ss requires mm"},
+		{format: "MM/DD", display: "date", err: "invalid format MM/DD, a date requires year, month and day"},
+		{format: "YYYY-MM-DD HH:mm", display: "date", err: "format YYYY-MM-DD HH:mm of a date display must only have date parts"},
+		{format: "YYYY-MM-DD", display: "time", err: "format YYYY-MM-DD of a time display must only have time parts"},
+		{format: "HH:mm", display: "date_time", err: "format HH:mm of a date_time display must have date and time parts"},
+	}
+	for _, test := range tests {
+		err := parseDateFormat(test.format, test.display)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s %s: unexpected error %s", test.display, test.format, err.Error())
+			}
+			continue
+		}
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%s %s: expected error %s, found %v", test.display, test.format, test.err, err)
+		}
+	}
+}
+
+func TestDefaultDateFormat(t *testing.T) {
+	tests := []struct {
+		languageCode string
+		display      string
+		expected     string
+	}{
+		{languageCode: "en-us", display: "date", expected: "MM/DD/YYYY"},
+		{languageCode: "en-US", display: "time", expected: "hh:mm A"},
+		{languageCode: "pt-br", display: "date_time", expected: "DD/MM/YYYY HH:mm"},
+		{languageCode: "de-de", display: "date", expected: "DD.MM.YYYY"},
+		{languageCode: "ja-jp", display: "date_time", expected: "YYYY-MM-DD HH:mm"},
+	}
+	for _, test := range tests {
+		format := defaultDateFormat(test.languageCode, test.display)
+		if format != test.expected {
+			t.Errorf("%s %s: expected %s, found %s", test.languageCode, test.display, test.expected, format)
+		}
+		if err := parseDateFormat(format, test.display); err != nil {
+			t.Errorf("%s %s: default format is invalid: %s", test.languageCode, test.display, err.Error())
+		}
+	}
+}
+
+func TestParseTimezone(t *testing.T) {
+	tests := []struct {
+		timezone string
+		valid    bool
+	}{
+		{timezone: "user", valid: true},
+		{timezone: "utc", valid: true},
+		{timezone: "America/Sao_Paulo", valid: true},
+		{timezone: "Europe/Berlin", valid: true},
+		{timezone: "-03:00", valid: true},
+		{timezone: "+14:00", valid: true},
+		{timezone: "UTC"},
+		{timezone: "Local"},
+		{timezone: "America/Nowhere"},
+		{timezone: "+15:00"},
+		{timezone: "-3:00"},
+		{timezone: "+05:60"},
+		{timezone: ""},
+	}
+	for _, test := range tests {
+		err := parseTimezone(test.timezone)
+		if test.valid && err != nil {
+			t.Errorf("%q: unexpected error %s", test.timezone, err.Error())
+		}
+		if !test.valid && (err == nil || !strings.Contains(err.Error(), "invalid timezone "+test.timezone+",")) {
+			t.Errorf("%q: expected an invalid timezone error, found %v", test.timezone, err)
+		}
+	}
+}
+
+func TestValidateDateField(t *testing.T) {
+	tests := []struct {
+		name      string
+		attrs     string
+		violation string
+	}{
+		{name: "defaults"},
+		{name: "format of the display", attrs: ` display="time" format="HH:mm" timezone="-03:00"`},
+		{name: "invalid display", attrs: ` display="week"`, violation: "task:createField: invalid display week, expected one of date, time, date_time"},
+		{name: "invalid display with a format", attrs: ` display="week" format="YYYY-MM-DD"`, violation: "invalid display week"},
+		{name: "format of another display", attrs: ` display="date" format="HH:mm"`, violation: "format HH:mm of a date display must only have date parts"},
+		{name: "format of the default display", attrs: ` format="YYYY-MM-DD"`, violation: "format YYYY-MM-DD of a date_time display must have date and time parts"},
+		{name: "invalid timezone", attrs: ` timezone="Mars/Olympus"`, violation: "task:createField: invalid timezone Mars/Olympus"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			module := testModule(`<task:createSchema code="tasks" name="Tasks">
+        <task:createField schemaCode="sys_mdl_tst_tasks" type="date" code="due" name="Due"` + test.attrs + ` />
+      </task:createSchema>`)
+			expected := []expectedViolation{}
+			if test.violation != "" {
+				expected = append(expected, expectedViolation{6, test.violation})
+			}
+			checkViolations(t, module, Options{}, expected)
+		})
+	}
+}
+
+func TestDatePayload(t *testing.T) {
+	x, err := parse(writeModule(t, testModule(`<task:createSchema code="tasks" name="Tasks">
+        <task:createField schemaCode="sys_mdl_tst_tasks" type="date" code="start" name="Start" />
+        <task:createField schemaCode="sys_mdl_tst_tasks" type="date" code="due" name="Due" display="date" format="DD/MM/YYYY" timezone="utc" />
+      </task:createSchema>`)), "", Options{})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	tests := []struct {
+		code     string
+		expected dateDefinitions
+	}{
+		{code: "start", expected: dateDefinitions{Display: "date_time", Format: "MM/DD/YYYY hh:mm A", Timezone: "user"}},
+		{code: "due", expected: dateDefinitions{Display: "date", Format: "DD/MM/YYYY", Timezone: "utc"}},
+	}
+	for _, test := range tests {
+		definitions := findTask(t, x, "createField", test.code).ExecPayload.(fieldPayload).Definitions.(*dateDefinitions)
+		if *definitions != test.expected {
+			t.Errorf("%s: expected %+v, found %+v", test.code, test.expected, *definitions)
+		}
+	}
+}
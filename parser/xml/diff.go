@@ -0,0 +1,264 @@
+package xml
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// updateElements maps the create elements to the update element used when their definition changes
+var updateElements = map[string]string{
+	"createSchema":  "updateSchema",
+	"createField":   "updateField",
+	"createDataset": "updateDataset",
+}
+
+// deleteElements maps the create elements to the delete element and the attributes identifying the entity
+var deleteElements = map[string][]string{
+	"createContent": {"deleteContent", "code"},
+	"createSchema":  {"deleteSchema", "code"},
+	"createField":   {"deleteField", "schemaCode", "code"},
+	"createDataset": {"deleteDataset", "code"},
+	"createFeature": {"deleteFeature", "moduleCode", "code"},
+	"createColumn":  {"dropColumn", "table", "code"},
+}
+
+// cascadeElements lists for each create element the nested entities the system deletes together with it
+var cascadeElements = map[string][]string{
+	"createContent": {"createSchema", "createField"},
+	"createSchema":  {"createField"},
+}
+
+// Diff compares two versions of a module and saves a job with the tasks needed to upgrade a system
+func Diff(fromFile, toFile, translationFile, jsonFile string, options Options) error {
+	fmt.Println("Starting module diff")
+	// both versions load the same translations so only changes of the module xml are compared
+	from, err := parse(fromFile, translationFile, options)
+	if err != nil {
+		return err
+	}
+	to, err := parse(toFile, translationFile, options)
+	if err != nil {
+		return err
+	}
+
+	x := &xml{
+		Version:      to.Version,
+		LanguageCode: to.LanguageCode,
+		ContentCode:  to.ContentCode,
+		Params:       to.Params,
+		Translations: to.Translations,
+	}
+	changes := []string{}
+	added, changed, removed := 0, 0, 0
+
+	fromTasks := entityTasks(from)
+	toTasks := entityTasks(to)
+
+	removedTasks := []task{}
+	for _, t := range from.Tasks {
+		if _, ok := fromTasks[t.Path]; !ok {
+			continue
+		}
+		if _, ok := toTasks[t.Path]; !ok {
+			removedTasks = append(removedTasks, t)
+		}
+	}
+	for _, t := range removedTasks {
+		if deletedWithAncestor(t, removedTasks) {
+			continue
+		}
+		if _, ok := deleteElements[t.Type]; !ok {
+			changes = append(changes, fmt.Sprintf("  ! %s %s removed and must be dropped manually", t.Type, t.Code))
+			continue
+		}
+		if err := x.deleteEntity(t); err != nil {
+			return err
+		}
+		changes = append(changes, fmt.Sprintf("  - %s %s", deleteElements[t.Type][0], t.Code))
+		removed++
+	}
+
+	for _, t := range to.Tasks {
+		if _, ok := toTasks[t.Path]; !ok {
+			continue
+		}
+		old, ok := fromTasks[t.Path]
+		if !ok {
+			x.Tasks = append(x.Tasks, t)
+			changes = append(changes, fmt.Sprintf("  + %s %s", t.Type, t.Code))
+			added++
+			continue
+		}
+		equal, err := sameTask(old, t)
+		if err != nil {
+			return err
+		}
+		if equal {
+			continue
+		}
+		if updateTag, ok := updateElements[t.Type]; ok {
+			if err := x.updateEntity(t, updateTag); err != nil {
+				return err
+			}
+			changes = append(changes, fmt.Sprintf("  ~ %s %s", updateTag, t.Code))
+			for _, definition := range removedDefinitions(old.Element, t.Element) {
+				changes = append(changes, fmt.Sprintf("  ! %s %s %s removed and must be migrated manually", updateTag, t.Code, definition))
+			}
+			changed++
+			continue
+		}
+		if t.Type == "createFeature" {
+			if err := x.deleteEntity(old); err != nil {
+				return err
+			}
+			x.Tasks = append(x.Tasks, t)
+			changes = append(changes, fmt.Sprintf("  -/+ %s %s", t.Type, t.Code))
+			changed++
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("  ! %s %s changed and must be migrated manually", t.Type, t.Code))
+	}
+
+	x.invalidateTranslations()
+
+	if err := x.verifyPayloads(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Module %s from version %s to %s\n", x.ContentCode, from.Version, to.Version)
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+	fmt.Printf("%d to add, %d to change, %d to remove\n", added, changed, removed)
+
+	if translationFile != "" {
+		if err := x.createTranslation(translationFile); err != nil {
+			return err
+		}
+	}
+
+	if jsonFile != "" {
+		if err := x.save(jsonFile); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("Finished module diff")
+	return nil
+}
+
+// entityTasks indexes the create tasks of a module by their translation path
+func entityTasks(x *xml) map[string]task {
+	tasks := make(map[string]task)
+	for _, t := range x.Tasks {
+		if strings.HasPrefix(t.Type, "create") && t.Path != "" {
+			tasks[t.Path] = t
+		}
+	}
+	return tasks
+}
+
+// deletedWithAncestor reports tasks whose entity the system deletes together with a removed ancestor,
+// a field belongs to the schema named by its schemaCode wherever it is nested
+func deletedWithAncestor(t task, removed []task) bool {
+	segment := t.Path[strings.LastIndex(t.Path, "/")+1:]
+	for _, ancestor := range removed {
+		if strings.HasPrefix(t.Path, ancestor.Path+"/") && contains(cascadeElements[ancestor.Type], t.Type) {
+			return true
+		}
+		if ancestor.Type != "createSchema" || t.Type != "createField" {
+			continue
+		}
+		for _, schemaSegment := range schemaFieldSegments(ancestor.Element, t.Type) {
+			if strings.HasPrefix(segment, schemaSegment+"[") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// removedDefinitions lists the attributes and definition elements of the old version missing from the new one,
+// an update only sends what the new version sets so they are not unset on the target system
+func removedDefinitions(old, new *etree.Element) []string {
+	removed := []string{}
+	for _, attr := range old.Attr {
+		if new.SelectAttr(attr.Key) == nil {
+			removed = append(removed, "attribute "+attr.Key)
+		}
+	}
+	for _, child := range old.ChildElements() {
+		// scale units are sent as a whole matrix with the scale attribute
+		if _, ok := moduleRules[child.Tag]; !ok || contains(taskElements, child.Tag) {
+			continue
+		}
+		definition := "element " + child.Tag
+		if new.SelectElement(child.Tag) == nil && !contains(removed, definition) {
+			removed = append(removed, definition)
+		}
+	}
+	return removed
+}
+
+func sameTask(a, b task) (bool, error) {
+	if a.ExecAddress != b.ExecAddress {
+		return false, nil
+	}
+	aPayload, err := decodePayload(a.ExecPayload)
+	if err != nil {
+		return false, err
+	}
+	bPayload, err := decodePayload(b.ExecPayload)
+	if err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(aPayload, bPayload), nil
+}
+
+func decodePayload(payload interface{}) (interface{}, error) {
+	payloadByte, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(payloadByte, &decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+func parentPath(path string) string {
+	return path[:strings.LastIndex(path, "/")]
+}
+
+// updateEntity runs the update handler over a copy of the create element without its nested tasks
+func (x *xml) updateEntity(t task, updateTag string) error {
+	element := t.Element.Copy()
+	element.Space = ""
+	element.Tag = updateTag
+	for _, child := range element.ChildElements() {
+		if contains(taskElements, child.Tag) || updateTag == "updateSchema" {
+			element.RemoveChild(child)
+		}
+	}
+	return x.processTask([]*etree.Element{element}, t.Sequence-1, parentPath(t.Path))
+}
+
+// deleteEntity runs the delete handler for the entity created by a task,
+// the delete element is added next to the create element while it runs so the handler sees the enclosing content
+func (x *xml) deleteEntity(t task) error {
+	definition := deleteElements[t.Type]
+	element := etree.NewElement(definition[0])
+	for _, attr := range definition[1:] {
+		element.CreateAttr(attr, t.Element.SelectAttrValue(attr, ""))
+	}
+	if parent := t.Element.Parent(); parent != nil {
+		parent.AddChild(element)
+		defer parent.RemoveChild(element)
+	}
+	return x.processTask([]*etree.Element{element}, t.Sequence-1, parentPath(t.Path))
+}
@@ -0,0 +1,232 @@
+package xml
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type diffTask struct {
+	Type        string          `json:"type"`
+	Code        string          `json:"code"`
+	Sequence    int             `json:"sequence"`
+	ExecPayload json.RawMessage `json:"exec_payload"`
+}
+
+// captureOutput returns what run prints to the standard output
+func captureOutput(t *testing.T, run func()) string {
+	t.Helper()
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	run()
+	w.Close()
+	os.Stdout = stdout
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+// runDiff saves both versions of a module and returns the tasks of the upgrade job and the printed changes
+func runDiff(t *testing.T, from, to string) ([]diffTask, string) {
+	t.Helper()
+	jsonFile := filepath.Join(t.TempDir(), "job.json")
+	fromFile, toFile := writeModule(t, from), writeModule(t, to)
+	var err error
+	out := captureOutput(t, func() {
+		err = Diff(fromFile, toFile, "", jsonFile, Options{})
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	data, err := ioutil.ReadFile(jsonFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := struct {
+		Tasks []diffTask `json:"tasks"`
+	}{}
+	if err := json.Unmarshal(data, &job); err != nil {
+		t.Fatal(err)
+	}
+	return job.Tasks, out
+}
+
+// checkDiffTasks expects the type and code of every task of the job in order
+func checkDiffTasks(t *testing.T, tasks []diffTask, expected []string) {
+	t.Helper()
+	found := []string{}
+	for _, task := range tasks {
+		found = append(found, task.Type+" "+task.Code)
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("expected tasks %v, found %v", expected, found)
+	}
+	for i := range expected {
+		if found[i] != expected[i] {
+			t.Errorf("expected tasks %v, found %v", expected, found)
+			return
+		}
+	}
+}
+
+func TestDiffDeletesFieldsWithTheirSchema(t *testing.T) {
+	from := testModule(`<task:createSchema code="tasks" name="Tasks">
+        <task:createField schemaCode="sys_mdl_tst_tasks" type="text" code="title" name="Title" />
+      </task:createSchema>
+      <task:createSchema code="notes" name="Notes" />
+      <task:createDataset type="dynamic" code="ds_tst_users" name="Users">
+        <query>select username from core_users</query>
+        <task:createField schemaCode="sys_mdl_tst_tasks" type="text" code="owner" name="Owner" />
+        <task:createField schemaCode="sys_mdl_tst_notes" type="text" code="author" name="Author" />
+      </task:createDataset>`)
+	to := testModule(`<task:createSchema code="notes" name="Notes" />
+      <task:createDataset type="dynamic" code="ds_tst_users" name="Users">
+        <query>select username from core_users</query>
+      </task:createDataset>`)
+
+	tasks, _ := runDiff(t, from, to)
+	checkDiffTasks(t, tasks, []string{"deleteSchema tasks", "deleteField author"})
+}
+
+func TestDeleteSchemaRemovesTheTranslationsOfItsFields(t *testing.T) {
+	x, err := parse(writeModule(t, testModule(`<task:deleteSchema code="tasks" />`)), "", Options{})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	for _, segment := range []string{
+		"createSchema[@code='tasks']",
+		"createField[@schemaCode='tasks']",
+		"createField[@schemaCode='sys_mdl_tst_tasks']",
+		"updateField[@schemaCode='sys_mdl_tst_tasks']",
+	} {
+		if !contains(x.Removed, segment) {
+			t.Errorf("expected %s in the removed translations %v", segment, x.Removed)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	schema := func(fields string) string {
+		return `<task:createSchema code="tasks" name="Tasks">
+        ` + fields + `
+      </task:createSchema>`
+	}
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		tasks   []string
+		changes []string
+	}{
+		{
+			name:    "same version",
+			from:    schema(`<task:createField schemaCode="sys_mdl_tst_tasks" type="text" code="title" name="Title" />`),
+			to:      schema(`<task:createField schemaCode="sys_mdl_tst_tasks" type="text" code="title" name="Title" />`),
+			changes: []string{"0 to add, 0 to change, 0 to remove"},
+		},
+		{
+			name:    "added field",
+			from:    schema(``),
+			to:      schema(`<task:createField schemaCode="sys_mdl_tst_tasks" type="text" code="title" name="Title" />`),
+			tasks:   []string{"createField title"},
+			changes: []string{"  + createField title", "1 to add, 0 to change, 0 to remove"},
+		},
+		{
+			name:    "removed field",
+			from:    schema(`<task:createField schemaCode="sys_mdl_tst_tasks" type="text" code="title" name="Title" />`),
+			to:      schema(``),
+			tasks:   []string{"deleteField title"},
+			changes: []string{"  - deleteField title", "0 to add, 0 to change, 1 to remove"},
+		},
+		{
+			name:    "changed field",
+			from:    schema(`<task:createField schemaCode="sys_mdl_tst_tasks" type="text" code="title" name="Title" />`),
+			to:      schema(`<task:createField schemaCode="sys_mdl_tst_tasks" type="text" code="title" name="Title" display="multi_line" />`),
+			tasks:   []string{"updateField title"},
+			changes: []string{"  ~ updateField title", "0 to add, 1 to change, 0 to remove"},
+		},
+		{
+			name:  "removed attribute",
+			from:  schema(`<task:createField schemaCode="sys_mdl_tst_tasks" type="text" code="title" name="Title" desc="Task title" default="new task" />`),
+			to:    schema(`<task:createField schemaCode="sys_mdl_tst_tasks" type="text" code="title" name="Title" />`),
+			tasks: []string{"updateField title"},
+			changes: []string{
+				"  ~ updateField title",
+				"  ! updateField title attribute desc removed and must be migrated manually",
+				"  ! updateField title attribute default removed and must be migrated manually",
+			},
+		},
+		{
+			name: "removed definition element",
+			from: schema(`<task:createField schemaCode="sys_mdl_tst_tasks" type="text" code="title" name="Title">
+          <validation required="true" />
+        </task:createField>`),
+			to:      schema(`<task:createField schemaCode="sys_mdl_tst_tasks" type="text" code="title" name="Title" />`),
+			tasks:   []string{"updateField title"},
+			changes: []string{"  ! updateField title element validation removed and must be migrated manually"},
+		},
+		{
+			name: "changed feature",
+			from: `<task:createFeature moduleCode="mdl_tst" code="board" name="Board">
+        <permission code="view" name="View" />
+      </task:createFeature>`,
+			to: `<task:createFeature moduleCode="mdl_tst" code="board" name="Board">
+        <permission code="view" name="View" />
+        <permission code="edit" name="Edit" />
+      </task:createFeature>`,
+			tasks:   []string{"deleteFeature board", "createFeature board"},
+			changes: []string{"  -/+ createFeature board", "0 to add, 1 to change, 0 to remove"},
+		},
+		{
+			name:    "changed column",
+			from:    schema(`<task:createColumn table="sys_mdl_tst_tasks" type="text" code="notes" />`),
+			to:      schema(`<task:createColumn table="sys_mdl_tst_tasks" type="jsonb" code="notes" />`),
+			changes: []string{"  ! createColumn sys_mdl_tst_tasks.notes changed and must be migrated manually"},
+		},
+		{
+			name: "removed index",
+			from: schema(`<task:createColumn table="sys_mdl_tst_tasks" type="text" code="notes" />
+        <task:createIndex table="sys_mdl_tst_tasks" code="notes_idx" columns="notes" />`),
+			to:      schema(`<task:createColumn table="sys_mdl_tst_tasks" type="text" code="notes" />`),
+			changes: []string{"  ! createIndex notes_idx removed and must be dropped manually", "0 to add, 0 to change, 0 to remove"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tasks, out := runDiff(t, testModule(test.from), testModule(test.to))
+			checkDiffTasks(t, tasks, test.tasks)
+			for _, change := range test.changes {
+				if !strings.Contains(out, change+"\n") {
+					t.Errorf("expected %q in the diff output\n%s", change, out)
+				}
+			}
+		})
+	}
+}
+
+func TestDiffInvalidVersion(t *testing.T) {
+	valid := writeModule(t, testModule(`<task:createSchema code="tasks" name="Tasks" />`))
+	invalid := writeModule(t, testModule(`<task:createSchema code="tasks" />`))
+	jsonFile := filepath.Join(t.TempDir(), "job.json")
+	for _, files := range [][2]string{{invalid, valid}, {valid, invalid}} {
+		var err error
+		captureOutput(t, func() {
+			err = Diff(files[0], files[1], "", jsonFile, Options{})
+		})
+		if err == nil || !strings.Contains(err.Error(), "missing required attribute name") {
+			t.Errorf("expected the invalid version to fail the diff, found %v", err)
+		}
+	}
+	if _, err := os.Stat(jsonFile); !os.IsNotExist(err) {
+		t.Errorf("expected no job saved for an invalid version")
+	}
+}
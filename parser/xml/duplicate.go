@@ -0,0 +1,88 @@
+package xml
+
+import (
+	"fmt"
+)
+
+type occurrence struct {
+	Node *node
+	Path string
+}
+
+// nodePath returns the path of an element using the same format the task handlers build for translations
+func nodePath(n *node, path string) string {
+	switch n.Name {
+	case "createContent", "createSchema", "createDataset", "updateSchema", "updateDataset",
+		"deleteContent", "deleteSchema", "deleteDataset":
+		return fmt.Sprintf("%s/%s[@code='%s']", path, n.Name, n.Attrs["code"])
+	case "createField", "updateField", "deleteField":
+		return fmt.Sprintf("%s/%s[@schemaCode='%s'][@code='%s']", path, n.Name, n.Attrs["schemaCode"], n.Attrs["code"])
+	case "createColumn", "dropColumn", "createIndex", "createConstraint":
+		return fmt.Sprintf("%s/%s[@table='%s'][@code='%s']", path, n.Name, n.Attrs["table"], n.Attrs["code"])
+	case "createFeature", "deleteFeature":
+		return fmt.Sprintf("%s/%s[@moduleCode='%s'][@code='%s']", path, n.Name, n.Attrs["moduleCode"], n.Attrs["code"])
+	case "permission":
+		return fmt.Sprintf("%s/permission[@code='%s']", path, n.Attrs["code"])
+	case "option":
+		return fmt.Sprintf("%s/options/option[@code='%s']", path, n.Attrs["code"])
+	case "field":
+		return fmt.Sprintf("%s/fields/field[@code='%s']", path, n.Attrs["code"])
+	}
+	return path
+}
+
+// entityKey returns the key that must be unique in the module for an element and its readable label
+func entityKey(n *node, path string) (string, string) {
+	label := ""
+	switch n.Name {
+	case "createContent", "createSchema", "createDataset", "updateSchema", "updateDataset",
+		"deleteContent", "deleteSchema", "deleteDataset", "permission", "option", "field":
+		label = fmt.Sprintf("%s %s", n.Name, n.Attrs["code"])
+	case "createField", "updateField", "deleteField":
+		label = fmt.Sprintf("%s %s.%s", n.Name, n.Attrs["schemaCode"], n.Attrs["code"])
+	case "createIndex":
+		label = fmt.Sprintf("%s %s", n.Name, n.Attrs["code"])
+	case "createColumn", "dropColumn", "createConstraint":
+		label = fmt.Sprintf("%s %s.%s", n.Name, n.Attrs["table"], n.Attrs["code"])
+	case "createFeature", "deleteFeature":
+		label = fmt.Sprintf("%s %s.%s", n.Name, n.Attrs["moduleCode"], n.Attrs["code"])
+	default:
+		return "", ""
+	}
+	switch n.Name {
+	case "permission", "option", "field":
+		return nodePath(n, path), label
+	}
+	return label, label
+}
+
+// findDuplicates reports every element whose code collides with a previous one,
+// invalid task elements are not compared but their nested elements are
+func findDuplicates(root *node, invalid map[*node]bool) []Violation {
+	violations := []Violation{}
+	seen := make(map[string]occurrence)
+	var walk func(n *node, path string)
+	walk = func(n *node, path string) {
+		for _, child := range n.Children {
+			childPath := path
+			if child.Name == "tasks" {
+				childPath = fmt.Sprintf("/%s/%s", root.Name, child.Name)
+			} else if path != "" {
+				childPath = nodePath(child, path)
+			}
+			if key, label := entityKey(child, path); key != "" && path != "" && !invalid[child] {
+				if first, ok := seen[key]; ok {
+					violations = append(violations, child.violation(
+						"%s: duplicate %s, first defined at %d:%d as %s, duplicated as %s",
+						child.qualifiedName(), label, first.Node.Line, first.Node.Column, first.Path, childPath,
+					))
+				} else {
+					seen[key] = occurrence{Node: child, Path: childPath}
+				}
+			}
+			walk(child, childPath)
+		}
+	}
+	walk(root, "")
+	return violations
+}
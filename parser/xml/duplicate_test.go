@@ -0,0 +1,99 @@
+package xml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	tests := []struct {
+		name     string
+		tasks    string
+		expected []expectedViolation
+	}{
+		{
+			name: "field in the same schema",
+			tasks: `<task:createSchema code="tasks" name="Tasks">
+        <task:createField schemaCode="sys_mdl_tst_tasks" type="text" code="title" name="Title" />
+        <task:createField schemaCode="sys_mdl_tst_tasks" type="text" code="title" name="Name" />
+      </task:createSchema>`,
+			expected: []expectedViolation{{7, "task:createField: duplicate createField sys_mdl_tst_tasks.title, " +
+				"first defined at 6:9 as /module/tasks/createContent[@code='mdl_tst']/createSchema[@code='tasks']/createField[@schemaCode='sys_mdl_tst_tasks'][@code='title'], " +
+				"duplicated as /module/tasks/createContent[@code='mdl_tst']/createSchema[@code='tasks']/createField[@schemaCode='sys_mdl_tst_tasks'][@code='title']"}},
+		},
+		{
+			name: "dataset code",
+			tasks: `<task:createDataset type="static" code="ds_tst_status" name="Status">
+        <options>
+          <option code="open" name="Open" />
+        </options>
+      </task:createDataset>
+      <task:createDataset type="dynamic" code="ds_tst_status" name="Status">
+        <query>select code from core_status</query>
+      </task:createDataset>`,
+			expected: []expectedViolation{{10, "duplicate createDataset ds_tst_status, first defined at 5:1"}},
+		},
+		{
+			name: "permission of a feature",
+			tasks: `<task:createFeature moduleCode="mdl_tst" code="board" name="Board">
+        <permission code="view" name="View" />
+        <permission code="view" name="View All" />
+      </task:createFeature>`,
+			expected: []expectedViolation{{7, "permission: duplicate permission view, first defined at 6:9 as " +
+				"/module/tasks/createContent[@code='mdl_tst']/createFeature[@moduleCode='mdl_tst'][@code='board']/permission[@code='view']"}},
+		},
+		{
+			name: "option of a dataset",
+			tasks: `<task:createDataset type="static" code="ds_tst_status" name="Status">
+        <options>
+          <option code="open" name="Open" />
+          <option code="open" name="Opened" />
+        </options>
+      </task:createDataset>`,
+			expected: []expectedViolation{{8, "duplicate option open"}},
+		},
+		{
+			name: "same codes in different parents",
+			tasks: `<task:createSchema code="tasks" name="Tasks">
+        <task:createField schemaCode="sys_mdl_tst_tasks" type="text" code="title" name="Title" />
+      </task:createSchema>
+      <task:createSchema code="baselines" name="Baselines">
+        <task:createField schemaCode="sys_mdl_tst_baselines" type="text" code="title" name="Title" />
+      </task:createSchema>
+      <task:createFeature moduleCode="mdl_tst" code="board" name="Board">
+        <permission code="view" name="View" />
+      </task:createFeature>
+      <task:createFeature moduleCode="mdl_tst" code="list" name="List">
+        <permission code="view" name="View" />
+      </task:createFeature>`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkViolations(t, testModule(test.tasks), Options{}, test.expected)
+		})
+	}
+}
+
+func TestAllowDuplicates(t *testing.T) {
+	xmlFile := writeModule(t, testModule(`<task:createFeature moduleCode="mdl_tst" code="board" name="Board">
+        <permission code="view" name="View" />
+        <permission code="view" name="View All" />
+      </task:createFeature>`))
+
+	_, err := parse(xmlFile, "", Options{})
+	if err == nil || !strings.Contains(err.Error(), "module.xml:7:9: permission: duplicate permission view") {
+		t.Errorf("expected the duplicate permission to fail the parse, found %v", err)
+	}
+
+	violations, err := Validate(xmlFile, Options{AllowDuplicates: true})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	if len(violations) != 0 {
+		t.Errorf("expected no violations with AllowDuplicates, found %v", violations)
+	}
+	if _, err := parse(xmlFile, "", Options{AllowDuplicates: true}); err != nil {
+		t.Errorf("unexpected error %s", err.Error())
+	}
+}
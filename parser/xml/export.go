@@ -0,0 +1,594 @@
+package xml
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/agile-work/srv-shared/constants"
+	"github.com/beevik/etree"
+)
+
+// Exporter reads a module definition from a running Horizon system
+type Exporter struct {
+	APIHost      string
+	APIToken     string
+	LanguageCode string
+	Client       *http.Client
+}
+
+type exportField struct {
+	Code        string            `json:"code"`
+	SchemaCode  string            `json:"schema_code"`
+	FieldType   string            `json:"field_type"`
+	Name        map[string]string `json:"name"`
+	Description map[string]string `json:"description"`
+	Definitions json.RawMessage   `json:"definitions"`
+	Validations *fieldValidations `json:"validations"`
+}
+
+type exportDataset struct {
+	Code        string            `json:"code"`
+	Name        map[string]string `json:"name"`
+	Type        string            `json:"type"`
+	Description map[string]string `json:"description"`
+	Definitions json.RawMessage   `json:"definitions"`
+}
+
+type exportDatasetOption struct {
+	Code   string            `json:"code"`
+	Name   map[string]string `json:"name"`
+	Active interface{}       `json:"active"`
+	Color  string            `json:"color"`
+	Icon   string            `json:"icon"`
+	Parent string            `json:"parent"`
+}
+
+type exportText struct {
+	Path  string
+	Code  string
+	Texts map[string]string
+}
+
+// exportModule holds the entities read from the system before writing the files
+type exportModule struct {
+	Content  contentPayload
+	Schemas  []schemaPayload
+	Fields   map[string][]exportField
+	Datasets []exportDataset
+	Features map[string]featurePayload
+	texts    []exportText
+}
+
+// Export writes the module xml and translation csv of a content installed on the system
+func (e *Exporter) Export(contentCode, xmlFile, translationFile string) error {
+	fmt.Println("Starting module export")
+	module, err := e.read(contentCode)
+	if err != nil {
+		return err
+	}
+
+	doc := etree.NewDocument()
+	root := doc.CreateElement("horizon:module")
+	root.CreateAttr("version", "1.0")
+	definition := root.CreateElement("definition")
+	definition.CreateAttr("languageCode", e.LanguageCode)
+	definition.CreateAttr("contentPackage", contentCode)
+	tasks := root.CreateElement("tasks")
+	if err := module.write(e.LanguageCode, tasks, tasks.GetPath()); err != nil {
+		return err
+	}
+
+	doc.Indent(2)
+	if err := doc.WriteToFile(xmlFile); err != nil {
+		return err
+	}
+	if translationFile != "" {
+		if err := module.writeTranslation(e.LanguageCode, translationFile); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("Finished module export")
+	return nil
+}
+
+func (e *Exporter) get(resource string, target interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(e.APIHost, "/")+resource, nil)
+	if err != nil {
+		return err
+	}
+	if e.APIToken != "" {
+		req.Header.Set("Authorization", e.APIToken)
+	}
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("GET %s: %s", resource, res.Status)
+	}
+
+	// responses may be wrapped in a data attribute
+	envelope := struct {
+		Data json.RawMessage `json:"data"`
+	}{}
+	if err := json.Unmarshal(body, &envelope); err == nil && len(envelope.Data) > 0 {
+		body = envelope.Data
+	}
+	if err := json.Unmarshal(body, target); err != nil {
+		return fmt.Errorf("GET %s: %s", resource, err.Error())
+	}
+	return nil
+}
+
+func (e *Exporter) read(contentCode string) (*exportModule, error) {
+	module := &exportModule{
+		Fields:   make(map[string][]exportField),
+		Features: make(map[string]featurePayload),
+	}
+
+	contents := []contentPayload{}
+	if err := e.get("/api/v1/core/admin/contents", &contents); err != nil {
+		return nil, err
+	}
+	found := false
+	for _, content := range contents {
+		if content.Code == contentCode {
+			module.Content = content
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("content %s not found", contentCode)
+	}
+
+	schemas := []schemaPayload{}
+	if err := e.get("/api/v1/core/admin/schemas", &schemas); err != nil {
+		return nil, err
+	}
+	datasetCodes := make(map[string]bool)
+	for _, schema := range schemas {
+		if schema.ContentCode != contentCode {
+			continue
+		}
+		module.Schemas = append(module.Schemas, schema)
+		fields := []exportField{}
+		if err := e.get(fmt.Sprintf("/api/v1/core/admin/schemas/%s/fields", schema.Code), &fields); err != nil {
+			return nil, err
+		}
+		module.Fields[schema.Code] = fields
+		for _, field := range fields {
+			for _, code := range fieldDatasets(field) {
+				datasetCodes[code] = true
+			}
+		}
+	}
+
+	datasets := []exportDataset{}
+	if err := e.get("/api/v1/core/admin/datasets", &datasets); err != nil {
+		return nil, err
+	}
+	for _, dataset := range datasets {
+		if datasetCodes[dataset.Code] {
+			module.Datasets = append(module.Datasets, dataset)
+		}
+	}
+
+	if module.Content.IsModule {
+		if err := e.get(fmt.Sprintf("/api/v1/core/admin/modules/%s/features", contentCode), &module.Features); err != nil {
+			return nil, err
+		}
+	}
+	return module, nil
+}
+
+// fieldDatasets returns the datasets referenced by a field definition
+func fieldDatasets(field exportField) []string {
+	codes := []string{}
+	switch field.FieldType {
+	case constants.FieldNumber:
+		definitions := numberDefinitions{}
+		if err := json.Unmarshal(field.Definitions, &definitions); err == nil && definitions.Scale != nil {
+			codes = append(codes, definitions.Scale.DatasetCode)
+		}
+	case constants.FieldLookup:
+		definitions := lookupDefinitions{}
+		if err := json.Unmarshal(field.Definitions, &definitions); err == nil && definitions.DatasetCode != "" {
+			codes = append(codes, definitions.DatasetCode)
+		}
+	}
+	return codes
+}
+
+// text registers the translations of an attribute and returns the text in the default language
+func (m *exportModule) text(languageCode, path, code string, texts map[string]string) string {
+	m.texts = append(m.texts, exportText{Path: path, Code: code, Texts: texts})
+	return texts[languageCode]
+}
+
+func (m *exportModule) write(languageCode string, tasks *etree.Element, path string) error {
+	content := tasks.CreateElement("task:createContent")
+	content.CreateAttr("code", m.Content.Code)
+	path = fmt.Sprintf("%s/createContent[@code='%s']", path, m.Content.Code)
+	content.CreateAttr("name", m.text(languageCode, path, "name", m.Content.Name))
+	content.CreateAttr("desc", m.text(languageCode, path, "description", m.Content.Description))
+	content.CreateAttr("prefix", m.Content.Prefix)
+	content.CreateAttr("module", strconv.FormatBool(m.Content.IsModule))
+	content.CreateAttr("system", strconv.FormatBool(m.Content.IsSystem))
+
+	for _, schema := range m.Schemas {
+		elmSchema := content.CreateElement("task:createSchema")
+		elmSchema.CreateAttr("code", schema.Code)
+		pathSchema := fmt.Sprintf("%s/createSchema[@code='%s']", path, schema.Code)
+		elmSchema.CreateAttr("name", m.text(languageCode, pathSchema, "name", schema.Name))
+		elmSchema.CreateAttr("desc", m.text(languageCode, pathSchema, "description", schema.Description))
+		for _, field := range m.Fields[schema.Code] {
+			if err := m.writeField(languageCode, elmSchema, pathSchema, field); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, dataset := range m.Datasets {
+		if err := m.writeDataset(languageCode, content, path, dataset); err != nil {
+			return err
+		}
+	}
+
+	codes := []string{}
+	for code := range m.Features {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		feature := m.Features[code]
+		elmFeature := content.CreateElement("task:createFeature")
+		elmFeature.CreateAttr("moduleCode", m.Content.Code)
+		elmFeature.CreateAttr("code", code)
+		pathFeature := fmt.Sprintf("%s/createFeature[@moduleCode='%s'][@code='%s']", path, m.Content.Code, code)
+		elmFeature.CreateAttr("name", m.text(languageCode, pathFeature, "name", feature.Name))
+		elmFeature.CreateAttr("desc", m.text(languageCode, pathFeature, "description", feature.Description))
+		permissions := []string{}
+		for permission := range feature.Permissions {
+			permissions = append(permissions, permission)
+		}
+		sort.Strings(permissions)
+		for _, permission := range permissions {
+			elmPermission := elmFeature.CreateElement("permission")
+			elmPermission.CreateAttr("code", permission)
+			pathPermission := fmt.Sprintf("%s/permission[@code='%s']", pathFeature, permission)
+			elmPermission.CreateAttr("name", m.text(languageCode, pathPermission, "name", feature.Permissions[permission]))
+		}
+	}
+	return nil
+}
+
+func (m *exportModule) writeField(languageCode string, parent *etree.Element, path string, field exportField) error {
+	element := parent.CreateElement("task:createField")
+	element.CreateAttr("schemaCode", field.SchemaCode)
+	element.CreateAttr("type", field.FieldType)
+	element.CreateAttr("code", field.Code)
+	path = fmt.Sprintf("%s/createField[@schemaCode='%s'][@code='%s']", path, field.SchemaCode, field.Code)
+	element.CreateAttr("name", m.text(languageCode, path, "name", field.Name))
+	element.CreateAttr("desc", m.text(languageCode, path, "description", field.Description))
+
+	switch field.FieldType {
+	case constants.FieldText:
+		definitions := textDefinitions{}
+		if err := json.Unmarshal(field.Definitions, &definitions); err != nil {
+			return fmt.Errorf("field %s: %s", field.Code, err.Error())
+		}
+		element.CreateAttr("display", definitions.Display)
+	case constants.FieldNumber:
+		definitions := numberDefinitions{}
+		if err := json.Unmarshal(field.Definitions, &definitions); err != nil {
+			return fmt.Errorf("field %s: %s", field.Code, err.Error())
+		}
+		element.CreateAttr("display", definitions.Display)
+		element.CreateAttr("decimals", strconv.Itoa(definitions.Decimals))
+		if definitions.Scale != nil {
+			element.CreateAttr("scale", definitions.Scale.DatasetCode)
+			for _, unit := range sortedKeys(definitions.Scale.AggrRates) {
+				elmUnit := element.CreateElement(unit)
+				rates := definitions.Scale.AggrRates[unit]
+				for _, target := range sortedKeys(rates) {
+					elmUnit.CreateElement(target).CreateAttr("value", strconv.FormatFloat(rates[target], 'f', -1, 64))
+				}
+			}
+		}
+	case constants.FieldDate:
+		definitions := dateDefinitions{}
+		if err := json.Unmarshal(field.Definitions, &definitions); err != nil {
+			return fmt.Errorf("field %s: %s", field.Code, err.Error())
+		}
+		element.CreateAttr("display", definitions.Display)
+		element.CreateAttr("format", definitions.Format)
+		if definitions.Timezone != "" {
+			element.CreateAttr("timezone", definitions.Timezone)
+		}
+	case constants.FieldLookup:
+		definitions := lookupDefinitions{}
+		if err := json.Unmarshal(field.Definitions, &definitions); err != nil {
+			return fmt.Errorf("field %s: %s", field.Code, err.Error())
+		}
+		element.CreateAttr("display", definitions.Display)
+		m.writeLookup(languageCode, element, path, definitions)
+	case fieldBoolean:
+		definitions := booleanDefinitions{}
+		if err := json.Unmarshal(field.Definitions, &definitions); err != nil {
+			return fmt.Errorf("field %s: %s", field.Code, err.Error())
+		}
+		element.CreateAttr("display", definitions.Display)
+	case fieldTextArea:
+		definitions := textAreaDefinitions{}
+		if err := json.Unmarshal(field.Definitions, &definitions); err != nil {
+			return fmt.Errorf("field %s: %s", field.Code, err.Error())
+		}
+		element.CreateAttr("display", definitions.Display)
+		if definitions.MaxLength > 0 {
+			element.CreateAttr("maxLength", strconv.Itoa(definitions.MaxLength))
+		}
+	case fieldMoney:
+		definitions := moneyDefinitions{}
+		if err := json.Unmarshal(field.Definitions, &definitions); err != nil {
+			return fmt.Errorf("field %s: %s", field.Code, err.Error())
+		}
+		element.CreateAttr("display", definitions.Display)
+		element.CreateAttr("currency", definitions.CurrencyCode)
+		element.CreateAttr("decimals", strconv.Itoa(definitions.Decimals))
+	case fieldPercentage:
+		definitions := percentageDefinitions{}
+		if err := json.Unmarshal(field.Definitions, &definitions); err != nil {
+			return fmt.Errorf("field %s: %s", field.Code, err.Error())
+		}
+		element.CreateAttr("display", definitions.Display)
+		element.CreateAttr("decimals", strconv.Itoa(definitions.Decimals))
+	case fieldAttachment:
+		definitions := attachmentDefinitions{}
+		if err := json.Unmarshal(field.Definitions, &definitions); err != nil {
+			return fmt.Errorf("field %s: %s", field.Code, err.Error())
+		}
+		element.CreateAttr("display", definitions.Display)
+		if definitions.MaxSize > 0 {
+			element.CreateAttr("maxSize", strconv.FormatInt(definitions.MaxSize, 10))
+		}
+		element.CreateAttr("maxFiles", strconv.Itoa(definitions.MaxFiles))
+		element.CreateAttr("thumbnail", strconv.FormatBool(definitions.Thumbnail))
+		if len(definitions.AcceptTypes) > 0 {
+			elmAccept := element.CreateElement("accept")
+			for _, mimeType := range definitions.AcceptTypes {
+				elmAccept.CreateElement("mime").CreateAttr("type", mimeType)
+			}
+		}
+	case fieldFormula:
+		definitions := formulaDefinitions{}
+		if err := json.Unmarshal(field.Definitions, &definitions); err != nil {
+			return fmt.Errorf("field %s: %s", field.Code, err.Error())
+		}
+		element.CreateAttr("display", definitions.Display)
+		element.CreateAttr("resultType", definitions.ResultType)
+		element.CreateAttr("decimals", strconv.Itoa(definitions.Decimals))
+		element.CreateElement("expression").SetText(definitions.Expression)
+	default:
+		return fmt.Errorf("field %s: unknown field type %s", field.Code, field.FieldType)
+	}
+	value := struct{ fieldDefault }{}
+	if err := json.Unmarshal(field.Definitions, &value); err != nil {
+		return fmt.Errorf("field %s: %s", field.Code, err.Error())
+	}
+	if value.Default != nil {
+		element.CreateAttr("default", formatValue(value.Default))
+	}
+	if value.DefaultExpression != "" {
+		element.CreateElement("default").SetText(value.DefaultExpression)
+	}
+	if field.Validations != nil {
+		writeValidations(element.CreateElement("validation"), field.Validations)
+	}
+	return nil
+}
+
+// formatValue writes a decoded json value as an attribute value
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(value)
+}
+
+func writeValidations(element *etree.Element, validations *fieldValidations) {
+	if validations.Required {
+		element.CreateAttr("required", "true")
+	}
+	if validations.Unique {
+		element.CreateAttr("unique", "true")
+	}
+	if validations.Min != nil {
+		element.CreateAttr("min", formatValue(validations.Min))
+	}
+	if validations.Max != nil {
+		element.CreateAttr("max", formatValue(validations.Max))
+	}
+	if validations.MinLength != nil {
+		element.CreateAttr("minLength", strconv.Itoa(*validations.MinLength))
+	}
+	if validations.MaxLength != nil {
+		element.CreateAttr("maxLength", strconv.Itoa(*validations.MaxLength))
+	}
+	if validations.Pattern != "" {
+		element.CreateAttr("pattern", validations.Pattern)
+	}
+}
+
+func (m *exportModule) writeLookup(languageCode string, parent *etree.Element, path string, definitions lookupDefinitions) {
+	element := parent.CreateElement("dataset")
+	element.CreateAttr("code", definitions.DatasetCode)
+	element.CreateAttr("type", definitions.LookupType)
+	if definitions.LookupType == constants.FieldLookupStatic {
+		return
+	}
+	element.CreateAttr("label", definitions.LookupLabel)
+	element.CreateAttr("value", definitions.LookupValue)
+	if len(definitions.SecurityGroups) > 0 {
+		element.CreateElement("groups").SetText(strings.Join(definitions.SecurityGroups, ","))
+	}
+	elmFields := element.CreateElement("fields")
+	for _, field := range definitions.LookupFields {
+		elmField := elmFields.CreateElement("field")
+		elmField.CreateAttr("code", field.Code)
+		pathField := fmt.Sprintf("%s/fields/field[@code='%s']", path, field.Code)
+		elmField.CreateAttr("name", m.text(languageCode, pathField, "name", field.Label))
+		if field.Filter != nil {
+			elmFilter := elmField.CreateElement("filter")
+			elmFilter.CreateAttr("type", field.Filter.ValueType)
+			writeValue(elmFilter, field.Filter.Value)
+			elmFilter.CreateAttr("operator", field.Filter.Operator)
+			elmFilter.CreateAttr("readonly", strconv.FormatBool(field.Filter.Readonly))
+		}
+	}
+	if len(definitions.LookupParams) > 0 {
+		elmParams := element.CreateElement("params")
+		for _, param := range definitions.LookupParams {
+			elmParam := elmParams.CreateElement("param")
+			elmParam.CreateAttr("code", param.Code)
+			elmParam.CreateAttr("type", param.ValueType)
+			writeValue(elmParam, param.Value)
+		}
+	}
+}
+
+func (m *exportModule) writeDataset(languageCode string, parent *etree.Element, path string, dataset exportDataset) error {
+	element := parent.CreateElement("task:createDataset")
+	element.CreateAttr("type", dataset.Type)
+	element.CreateAttr("code", dataset.Code)
+	path = fmt.Sprintf("%s/createDataset[@code='%s']", path, dataset.Code)
+	element.CreateAttr("name", m.text(languageCode, path, "name", dataset.Name))
+	element.CreateAttr("desc", m.text(languageCode, path, "description", dataset.Description))
+
+	if dataset.Type == constants.DatasetStatic {
+		definitions := struct {
+			Order   []string                       `json:"order"`
+			Options map[string]exportDatasetOption `json:"options"`
+		}{}
+		if err := json.Unmarshal(dataset.Definitions, &definitions); err != nil {
+			return fmt.Errorf("dataset %s: %s", dataset.Code, err.Error())
+		}
+		elmOptions := element.CreateElement("options")
+		for _, code := range definitions.Order {
+			option := definitions.Options[code]
+			elmOption := elmOptions.CreateElement("option")
+			elmOption.CreateAttr("code", code)
+			pathOption := fmt.Sprintf("%s/options/option[@code='%s']", path, code)
+			elmOption.CreateAttr("name", m.text(languageCode, pathOption, "name", option.Name))
+			// datasets created before active was a boolean store it as a string
+			if option.Active == false || option.Active == "false" {
+				elmOption.CreateAttr("active", "false")
+			}
+			for _, attr := range [][2]string{{"color", option.Color}, {"icon", option.Icon}, {"parent", option.Parent}} {
+				if attr[1] != "" {
+					elmOption.CreateAttr(attr[0], attr[1])
+				}
+			}
+		}
+		return nil
+	}
+
+	definitions := dynamicDatasetDefinitions{}
+	if err := json.Unmarshal(dataset.Definitions, &definitions); err != nil {
+		return fmt.Errorf("dataset %s: %s", dataset.Code, err.Error())
+	}
+	element.CreateElement("query").SetText(definitions.Query)
+	return nil
+}
+
+// writeTranslation saves every language returned by the system in the translation csv
+func (m *exportModule) writeTranslation(languageCode, translationFile string) error {
+	languages := make(map[string]bool)
+	for _, t := range m.texts {
+		for code := range t.Texts {
+			languages[code] = true
+		}
+	}
+	delete(languages, languageCode)
+	header := []string{"valid", "path", "code", languageCode}
+	for _, code := range sortedKeys(languages) {
+		header = append(header, code)
+	}
+
+	x := &xml{
+		LanguageCode: languageCode,
+		Translations: &translation{
+			Structure: translationStructure{
+				CSVHeader:       header,
+				CSVTranslations: make(map[string]csvTranslation),
+			},
+		},
+	}
+	for _, t := range m.texts {
+		row := csvTranslation{
+			Valid: true,
+			Path:  t.Path,
+			Code:  t.Code,
+		}
+		for _, code := range header[3:] {
+			row.Languages = append(row.Languages, language{Code: code, Text: t.Texts[code]})
+		}
+		x.Translations.Structure.CSVTranslations[t.Path+t.Code] = row
+	}
+	return x.createTranslation(translationFile)
+}
+
+// writeValue sets the value, valueType and itemType attributes of a decoded json value
+func writeValue(element *etree.Element, value interface{}) {
+	if items, ok := value.([]interface{}); ok {
+		texts := []string{}
+		itemType := valueString
+		for _, item := range items {
+			texts = append(texts, formatValue(item))
+			itemType = exportValueType(item)
+		}
+		element.CreateAttr("value", strings.Join(texts, ","))
+		element.CreateAttr("valueType", valueList)
+		element.CreateAttr("itemType", itemType)
+		return
+	}
+	if value == nil {
+		element.CreateAttr("value", "")
+	} else {
+		element.CreateAttr("value", formatValue(value))
+	}
+	element.CreateAttr("valueType", exportValueType(value))
+}
+
+func exportValueType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return valueNull
+	case bool:
+		return valueBoolean
+	case float64:
+		if v == math.Trunc(v) {
+			return valueInteger
+		}
+		return valueDecimal
+	}
+	return valueString
+}
@@ -0,0 +1,120 @@
+package xml
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fixtureServer answers the admin api with the recorded responses of testdata/export,
+// a resource is stored in a file named after its path with / replaced by _
+func fixtureServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet || req.Header.Get("Authorization") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		resource := strings.TrimPrefix(req.URL.Path, "/api/v1/core/admin/")
+		body, err := ioutil.ReadFile(filepath.Join("testdata", "export", strings.Replace(resource, "/", "_", -1)+".json"))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestExportWritesAValidModule(t *testing.T) {
+	server := fixtureServer(t)
+	dir := t.TempDir()
+	xmlFile := filepath.Join(dir, "module.xml")
+	translationFile := filepath.Join(dir, "module.csv")
+
+	exporter := &Exporter{APIHost: server.URL, APIToken: "token", LanguageCode: "en-us", Client: server.Client()}
+	if err := exporter.Export("mdl_tst", xmlFile, translationFile); err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+
+	violations, err := Validate(xmlFile, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	for _, v := range violations {
+		t.Errorf("exported module is invalid: %s", v.String())
+	}
+
+	data, err := ioutil.ReadFile(xmlFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	module := string(data)
+	for _, expected := range []string{
+		`<task:createContent code="mdl_tst"`,
+		`<task:createField schemaCode="sys_mdl_tst_tasks" type="lookup" code="owner"`,
+		`<task:createDataset type="dynamic" code="ds_tst_users"`,
+		`<option code="archived" name="Archived" active="false"/>`,
+		`<task:createFeature moduleCode="mdl_tst" code="board"`,
+	} {
+		if !strings.Contains(module, expected) {
+			t.Errorf("expected %s in the exported module", expected)
+		}
+	}
+	for _, unexpected := range []string{`code="other"`, `code="notes"`, `code="ds_unused"`} {
+		if strings.Contains(module, unexpected) {
+			t.Errorf("unexpected %s in the exported module", unexpected)
+		}
+	}
+
+	translations, err := ioutil.ReadFile(translationFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(translations), "Tarefas") {
+		t.Errorf("expected the pt-br name of schema tasks in the translation csv")
+	}
+
+	x, err := parse(xmlFile, translationFile, Options{})
+	if err != nil {
+		t.Fatalf("exported module does not parse: %s", err.Error())
+	}
+	if len(x.Tasks) == 0 {
+		t.Error("expected tasks from the exported module")
+	}
+}
+
+func TestExportUnknownContent(t *testing.T) {
+	server := fixtureServer(t)
+	exporter := &Exporter{APIHost: server.URL, APIToken: "token", LanguageCode: "en-us", Client: server.Client()}
+	err := exporter.Export("mdl_missing", filepath.Join(t.TempDir(), "module.xml"), "")
+	if err == nil || !strings.Contains(err.Error(), "content mdl_missing not found") {
+		t.Errorf("expected content mdl_missing not found, found %v", err)
+	}
+}
+
+func TestExportReplacesAnExistingTranslation(t *testing.T) {
+	server := fixtureServer(t)
+	dir := t.TempDir()
+	translationFile := filepath.Join(dir, "module.csv")
+	stale := "path,en-us\n" + strings.Repeat("/module/tasks/createSchema[@code='stale'],Stale\n", 200)
+	if err := ioutil.WriteFile(translationFile, []byte(stale), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	exporter := &Exporter{APIHost: server.URL, APIToken: "token", LanguageCode: "en-us", Client: server.Client()}
+	if err := exporter.Export("mdl_tst", filepath.Join(dir, "module.xml"), translationFile); err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+
+	translations, err := ioutil.ReadFile(translationFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(translations), "Stale") {
+		t.Errorf("expected the rows of the previous translation csv to be removed")
+	}
+}
@@ -1,26 +1,29 @@
 package xml
 
 import (
-	"encoding/json"
 	"fmt"
 
 	"github.com/agile-work/srv-shared/constants"
 	"github.com/beevik/etree"
 )
 
+type featurePayload struct {
+	Name        map[string]string            `json:"name"`
+	Description map[string]string            `json:"description"`
+	Permissions map[string]map[string]string `json:"permissions"`
+}
+
 func createFeature(x *xml, element *etree.Element, taskSequence int, path string) error {
 	elmModuleCode := element.SelectAttrValue("moduleCode", "")
 	elmCode := element.SelectAttrValue("code", "")
 	elmName := element.SelectAttrValue("name", "")
 	elmDescription := element.SelectAttrValue("desc", "")
-	permissions := make(map[string]interface{})
 
 	path = fmt.Sprintf("%s/createFeature[@moduleCode='%s'][@code='%s']", path, elmModuleCode, elmCode)
-	if err := x.processTranslation(path, "name", &elmName); err != nil {
-		return err
-	}
-	if err := x.processTranslation(path, "description", &elmDescription); err != nil {
-		return err
+	feature := featurePayload{
+		Name:        x.processTranslation(path, "name", elmName),
+		Description: x.processTranslation(path, "description", elmDescription),
+		Permissions: make(map[string]map[string]string),
 	}
 
 	for _, p := range element.SelectElements("permission") {
@@ -28,28 +31,20 @@ func createFeature(x *xml, element *etree.Element, taskSequence int, path string
 		name := p.SelectAttrValue("name", "")
 
 		pathPermission := fmt.Sprintf("%s/permission[@code='%s']", path, code)
-		if err := x.processTranslation(pathPermission, "name", &name); err != nil {
-			return err
-		}
-
-		permissions[code] = (json.RawMessage)([]byte(name))
-	}
-	permissionsByte, err := json.MarshalIndent(permissions, "", "  ")
-	if err != nil {
-		return err
+		feature.Permissions[code] = x.processTranslation(pathPermission, "name", name)
 	}
 
 	task := task{
+		Type:        "createFeature",
+		Code:        elmCode,
+		Path:        path,
+		Element:     element,
 		Sequence:    taskSequence,
 		ExecAction:  constants.ExecuteAPIPost,
 		ExecAddress: fmt.Sprintf("{system.api_host}/api/v1/core/admin/modules/%s/features", elmModuleCode),
-		ExecPayload: (json.RawMessage)([]byte(fmt.Sprintf(`{
-			"%s": {
-				"name": %s,
-				"description": %s,
-				"permissions": %s
-			}
-		}`, elmCode, elmName, elmDescription, string(permissionsByte)))),
+		ExecPayload: map[string]featurePayload{
+			elmCode: feature,
+		},
 	}
 
 	x.Tasks = append(x.Tasks, task)
@@ -59,3 +54,16 @@ func createFeature(x *xml, element *etree.Element, taskSequence int, path string
 	}
 	return nil
 }
+
+func deleteFeature(x *xml, element *etree.Element, taskSequence int) error {
+	elmModuleCode := element.SelectAttrValue("moduleCode", "")
+	elmCode := element.SelectAttrValue("code", "")
+
+	task, err := deleteTask(element, taskSequence, elmCode, fmt.Sprintf("{system.api_host}/api/v1/core/admin/modules/%s/features/%s", elmModuleCode, elmCode))
+	if err != nil {
+		return err
+	}
+	x.Tasks = append(x.Tasks, task)
+	x.removeTranslations(fmt.Sprintf("createFeature[@moduleCode='%s'][@code='%s']", elmModuleCode, elmCode))
+	return nil
+}
@@ -3,14 +3,186 @@ package xml
 import (
 	"encoding/json"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/agile-work/cli/action"
 	"github.com/agile-work/srv-shared/constants"
 
 	"github.com/beevik/etree"
 )
 
+// Field types handled by the parser besides the ones defined by the shared constants
+const (
+	fieldBoolean    = "boolean"
+	fieldTextArea   = "textarea"
+	fieldMoney      = "money"
+	fieldPercentage = "percentage"
+	fieldAttachment = "attachment"
+	fieldFormula    = "formula"
+)
+
+// fieldTypes are the field types accepted by createField and updateField
+var fieldTypes = []string{
+	constants.FieldText, constants.FieldNumber, constants.FieldDate, constants.FieldLookup,
+	fieldBoolean, fieldTextArea, fieldMoney, fieldPercentage, fieldAttachment, fieldFormula,
+}
+
+var (
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+	mimePattern     = regexp.MustCompile(`^[a-z0-9][a-z0-9!#$&^_.+-]*/(\*|[a-z0-9][a-z0-9!#$&^_.+-]*)$`)
+	sizePattern     = regexp.MustCompile(`^([0-9]+)(B|KB|MB|GB)?$`)
+)
+
+// sizeUnits maps the units accepted by maxSize to their number of bytes
+var sizeUnits = map[string]int64{
+	"":   1,
+	"B":  1,
+	"KB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+}
+
+type fieldPayload struct {
+	Code        string            `json:"code"`
+	ContentCode string            `json:"content_code"`
+	SchemaCode  string            `json:"schema_code"`
+	FieldType   string            `json:"field_type"`
+	Name        map[string]string `json:"name"`
+	Description map[string]string `json:"description"`
+	Active      bool              `json:"active"`
+	Definitions interface{}       `json:"definitions,omitempty"`
+	Validations *fieldValidations `json:"validations,omitempty"`
+}
+
+type fieldUpdatePayload struct {
+	Name        map[string]string      `json:"name,omitempty"`
+	Description map[string]string      `json:"description,omitempty"`
+	Definitions map[string]interface{} `json:"definitions,omitempty"`
+	Validations *fieldValidations      `json:"validations,omitempty"`
+}
+
+type fieldValidations struct {
+	Required  bool        `json:"required,omitempty"`
+	Unique    bool        `json:"unique,omitempty"`
+	Min       interface{} `json:"min,omitempty"`
+	Max       interface{} `json:"max,omitempty"`
+	MinLength *int        `json:"min_length,omitempty"`
+	MaxLength *int        `json:"max_length,omitempty"`
+	Pattern   string      `json:"pattern,omitempty"`
+}
+
+// fieldDefault is embedded in the definitions of the field types accepting a default value
+type fieldDefault struct {
+	Default           interface{} `json:"default,omitempty"`
+	DefaultExpression string      `json:"default_expression,omitempty"`
+}
+
+type defaultDefinitions interface {
+	setDefault(fieldDefault)
+}
+
+func (d *fieldDefault) setDefault(value fieldDefault) {
+	*d = value
+}
+
+type textDefinitions struct {
+	Display string `json:"display"`
+	fieldDefault
+}
+
+type booleanDefinitions struct {
+	Display string `json:"display"`
+	fieldDefault
+}
+
+type textAreaDefinitions struct {
+	Display   string `json:"display"`
+	MaxLength int    `json:"max_length,omitempty"`
+	fieldDefault
+}
+
+type moneyDefinitions struct {
+	Display      string `json:"display"`
+	CurrencyCode string `json:"currency_code"`
+	Decimals     int    `json:"decimals"`
+	fieldDefault
+}
+
+type percentageDefinitions struct {
+	Display  string `json:"display"`
+	Decimals int    `json:"decimals"`
+	fieldDefault
+}
+
+type attachmentDefinitions struct {
+	Display     string   `json:"display"`
+	AcceptTypes []string `json:"accept_types,omitempty"`
+	MaxSize     int64    `json:"max_size,omitempty"`
+	MaxFiles    int      `json:"max_files"`
+	Thumbnail   bool     `json:"thumbnail"`
+}
+
+type formulaDefinitions struct {
+	Display      string   `json:"display"`
+	ResultType   string   `json:"result_type"`
+	Decimals     int      `json:"decimals"`
+	Expression   string   `json:"expression"`
+	Dependencies []string `json:"dependencies"`
+}
+
+type numberDefinitions struct {
+	Display  string       `json:"display"`
+	Decimals int          `json:"decimals"`
+	Scale    *numberScale `json:"scale,omitempty"`
+	fieldDefault
+}
+
+type numberScale struct {
+	DatasetCode string                        `json:"dataset_code"`
+	AggrRates   map[string]map[string]float64 `json:"aggr_rates,omitempty"`
+}
+
+type dateDefinitions struct {
+	Display  string `json:"display"`
+	Format   string `json:"format"`
+	Timezone string `json:"timezone"`
+	fieldDefault
+}
+
+type lookupDefinitions struct {
+	Display        string        `json:"display"`
+	DatasetCode    string        `json:"dataset_code"`
+	LookupType     string        `json:"lookup_type"`
+	LookupLabel    string        `json:"lookup_label,omitempty"`
+	LookupValue    string        `json:"lookup_value,omitempty"`
+	LookupFields   []lookupField `json:"lookup_fields,omitempty"`
+	LookupParams   []lookupParam `json:"lookup_params,omitempty"`
+	SecurityGroups []string      `json:"security_groups,omitempty"`
+	fieldDefault
+}
+
+type lookupField struct {
+	Code   string            `json:"code"`
+	Label  map[string]string `json:"label"`
+	Filter *lookupFilter     `json:"filter,omitempty"`
+}
+
+type lookupFilter struct {
+	ValueType string      `json:"value_type"`
+	Value     interface{} `json:"value"`
+	Operator  string      `json:"operator"`
+	Readonly  bool        `json:"readonly"`
+}
+
+type lookupParam struct {
+	Code      string      `json:"code"`
+	ValueType string      `json:"value_type"`
+	Value     interface{} `json:"value"`
+}
+
 func createField(x *xml, element *etree.Element, taskSequence int, path string) error {
 	elmSchemaCode := element.SelectAttrValue("schemaCode", "")
 	elmType := element.SelectAttrValue("type", "")
@@ -19,51 +191,81 @@ func createField(x *xml, element *etree.Element, taskSequence int, path string)
 	elmDescription := element.SelectAttrValue("desc", "")
 
 	path = fmt.Sprintf("%s/createField[@schemaCode='%s'][@code='%s']", path, elmSchemaCode, elmCode)
-	if err := x.processTranslation(path, "name", &elmName); err != nil {
+	payload := fieldPayload{
+		Code:        elmCode,
+		ContentCode: x.ContentCode,
+		SchemaCode:  elmSchemaCode,
+		FieldType:   elmType,
+		Name:        x.processTranslation(path, "name", elmName),
+		Description: x.processTranslation(path, "description", elmDescription),
+		Active:      true,
+	}
+
+	definitions, err := processFieldDefinitions(x, element, elmType, path)
+	if err != nil {
 		return err
 	}
-	if err := x.processTranslation(path, "description", &elmDescription); err != nil {
+	payload.Definitions = definitions
+	payload.Validations, err = processFieldValidations(element, elmType)
+	if err != nil {
 		return err
 	}
 
-	payload := fmt.Sprintf(`
-		"code": "%s",
-		"content_code": "%s",
-		"schema_code": "%s",
-		"field_type": "%s",
-		"name": %s,
-		"description": %s,
-		"active": true
-	`, elmCode, x.ContentCode, elmSchemaCode, elmType, elmName, elmDescription)
+	task := task{
+		Type:        "createField",
+		Code:        elmCode,
+		Path:        path,
+		Element:     element,
+		Sequence:    taskSequence,
+		ExecAction:  constants.ExecuteAPIPost,
+		ExecAddress: fmt.Sprintf("{system.api_host}/api/v1/core/admin/schemas/%s/fields", elmSchemaCode),
+		ExecPayload: payload,
+	}
+
+	x.Tasks = append(x.Tasks, task)
 
-	switch elmType {
-	case constants.FieldText:
-		payload = processTextPayload(element, payload)
-		break
-	case constants.FieldNumber:
-		var err error
-		payload, err = processNumberPayload(element, payload)
-		if err != nil {
-			return err
-		}
-		break
-	case constants.FieldDate:
-		payload = processDatePayload(element, payload)
-		break
-	case constants.FieldLookup:
-		var err error
-		payload, err = processLookupPayload(x, element, payload, path)
-		if err != nil {
-			return err
-		}
-		break
+	if err := x.processTask(element.ChildElements(), taskSequence, path); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updateField(x *xml, element *etree.Element, taskSequence int, path string) error {
+	elmSchemaCode := element.SelectAttrValue("schemaCode", "")
+	elmType := element.SelectAttrValue("type", "")
+	elmCode := element.SelectAttrValue("code", "")
+
+	path = fmt.Sprintf("%s/updateField[@schemaCode='%s'][@code='%s']", path, elmSchemaCode, elmCode)
+	payload := fieldUpdatePayload{}
+	if elmName := element.SelectAttr("name"); elmName != nil {
+		payload.Name = x.processTranslation(path, "name", elmName.Value)
+	}
+	if elmDescription := element.SelectAttr("desc"); elmDescription != nil {
+		payload.Description = x.processTranslation(path, "description", elmDescription.Value)
+	}
+
+	definitions, err := processFieldDefinitions(x, element, elmType, path)
+	if err != nil {
+		return err
+	}
+	payload.Definitions, err = presentDefinitions(element, definitions)
+	if err != nil {
+		return err
+	}
+	payload.Validations, err = processFieldValidations(element, elmType)
+	if err != nil {
+		return err
 	}
 
 	task := task{
+		Type:        "updateField",
+		Code:        elmCode,
+		Path:        path,
+		Element:     element,
 		Sequence:    taskSequence,
-		ExecAction:  constants.ExecuteAPIPost,
-		ExecAddress: fmt.Sprintf("{system.api_host}/api/v1/core/admin/schemas/%s/fields", elmSchemaCode),
-		ExecPayload: (json.RawMessage)([]byte(payload)),
+		ExecAction:  action.ExecuteAPIPatch,
+		ExecAddress: fmt.Sprintf("{system.api_host}/api/v1/core/admin/schemas/%s/fields/%s", elmSchemaCode, elmCode),
+		ExecPayload: payload,
 	}
 
 	x.Tasks = append(x.Tasks, task)
@@ -74,172 +276,635 @@ func createField(x *xml, element *etree.Element, taskSequence int, path string)
 	return nil
 }
 
-func processTextPayload(element *etree.Element, payload string) string {
-	elmDisplay := element.SelectAttrValue("display", "single_line")
-	payload = fmt.Sprintf(`{
-			%s,
-			"definitions": {
-				"display": "%s"
+func deleteField(x *xml, element *etree.Element, taskSequence int) error {
+	elmSchemaCode := element.SelectAttrValue("schemaCode", "")
+	elmCode := element.SelectAttrValue("code", "")
+
+	task, err := deleteTask(element, taskSequence, elmCode, fmt.Sprintf("{system.api_host}/api/v1/core/admin/schemas/%s/fields/%s", elmSchemaCode, elmCode))
+	if err != nil {
+		return err
+	}
+	x.Tasks = append(x.Tasks, task)
+	x.removeTranslations(
+		fmt.Sprintf("createField[@schemaCode='%s'][@code='%s']", elmSchemaCode, elmCode),
+		fmt.Sprintf("updateField[@schemaCode='%s'][@code='%s']", elmSchemaCode, elmCode),
+	)
+	return nil
+}
+
+func processFieldDefinitions(x *xml, element *etree.Element, fieldType, path string) (interface{}, error) {
+	definitions, err := processTypeDefinitions(x, element, fieldType, path)
+	if err != nil {
+		return nil, err
+	}
+	fieldDefault, err := processFieldDefault(element, fieldType)
+	if err != nil {
+		return nil, fmt.Errorf("field %s: %s", element.SelectAttrValue("code", ""), err.Error())
+	}
+	if withDefault, ok := definitions.(defaultDefinitions); ok {
+		withDefault.setDefault(fieldDefault)
+	}
+	return definitions, nil
+}
+
+func processTypeDefinitions(x *xml, element *etree.Element, fieldType, path string) (interface{}, error) {
+	switch fieldType {
+	case constants.FieldText:
+		return processTextPayload(element), nil
+	case constants.FieldNumber:
+		return processNumberPayload(element)
+	case constants.FieldDate:
+		return processDatePayload(x, element)
+	case constants.FieldLookup:
+		return processLookupPayload(x, element, path)
+	case fieldBoolean:
+		return processBooleanPayload(element), nil
+	case fieldTextArea:
+		return processTextAreaPayload(element)
+	case fieldMoney:
+		return processMoneyPayload(element)
+	case fieldPercentage:
+		return processPercentagePayload(element)
+	case fieldAttachment:
+		return processAttachmentPayload(element)
+	case fieldFormula:
+		return processFormulaPayload(element)
+	}
+	return nil, fmt.Errorf("field %s: unknown field type %s", element.SelectAttrValue("code", ""), fieldType)
+}
+
+// definitionAttributes maps the definitions keys to the attribute that sets them
+var definitionAttributes = map[string]string{
+	"display":       "display",
+	"decimals":      "decimals",
+	"format":        "format",
+	"scale":         "scale",
+	"max_length":    "maxLength",
+	"currency_code": "currency",
+	"max_size":      "maxSize",
+	"max_files":     "maxFiles",
+	"thumbnail":     "thumbnail",
+	"result_type":   "resultType",
+	"default":       "default",
+	"timezone":      "timezone",
+}
+
+// definitionElements maps the definitions keys to the child element that sets them
+var definitionElements = map[string]string{
+	"accept_types":       "accept",
+	"expression":         "expression",
+	"dependencies":       "expression",
+	"default_expression": "default",
+}
+
+// presentDefinitions keeps only the definitions set by attributes or elements present in the element
+func presentDefinitions(element *etree.Element, definitions interface{}) (map[string]interface{}, error) {
+	if definitions == nil {
+		return nil, nil
+	}
+	definitionsByte, err := json.Marshal(definitions)
+	if err != nil {
+		return nil, err
+	}
+	present := make(map[string]interface{})
+	if err := json.Unmarshal(definitionsByte, &present); err != nil {
+		return nil, err
+	}
+	for key := range present {
+		if attr, ok := definitionAttributes[key]; ok {
+			if element.SelectAttr(attr) == nil {
+				delete(present, key)
 			}
-		}`, payload, elmDisplay)
-	return payload
+		} else if child, ok := definitionElements[key]; ok {
+			if element.SelectElement(child) == nil {
+				delete(present, key)
+			}
+		} else if element.SelectElement("dataset") == nil {
+			delete(present, key)
+		}
+	}
+	if len(present) == 0 {
+		return nil, nil
+	}
+	return present, nil
 }
 
-func processNumberPayload(element *etree.Element, payload string) (string, error) {
+func processTextPayload(element *etree.Element) *textDefinitions {
+	return &textDefinitions{
+		Display: element.SelectAttrValue("display", "single_line"),
+	}
+}
+
+func processNumberPayload(element *etree.Element) (*numberDefinitions, error) {
 	elmDisplay := element.SelectAttrValue("display", "number")
 	elmDecimals := element.SelectAttrValue("decimals", "0")
 	elmScale := element.SelectAttrValue("scale", "")
-	elmScaleItems := element.ChildElements()
-	payloadScale := ""
-	payloadDataset := ""
-	payloadAggRates := ""
+	elmScaleItems := []*etree.Element{}
+	for _, child := range element.ChildElements() {
+		if !contains(moduleRules["createField"].Children, child.Tag) && !contains(taskElements, child.Tag) {
+			elmScaleItems = append(elmScaleItems, child)
+		}
+	}
+
+	decimals, err := strconv.Atoi(elmDecimals)
+	if err != nil {
+		return nil, fmt.Errorf("invalid decimals %s", elmDecimals)
+	}
+	definitions := &numberDefinitions{
+		Display:  elmDisplay,
+		Decimals: decimals,
+	}
 	if elmScale != "" {
-		payloadDataset = fmt.Sprintf(`"dataset_code": "%s"`, elmScale)
-	}
-	if len(elmScaleItems) > 0 {
-		items := make(map[string]interface{})
-		for _, elmScaleItem := range elmScaleItems {
-			elmScaleItemValues := elmScaleItem.ChildElements()
-			values := make(map[string]interface{})
-			for _, elmScaleItemValue := range elmScaleItemValues {
-				values[elmScaleItemValue.Tag] = elmScaleItemValue.SelectAttrValue("value", "0")
+		definitions.Scale = &numberScale{
+			DatasetCode: elmScale,
+		}
+		if len(elmScaleItems) > 0 {
+			definitions.Scale.AggrRates = make(map[string]map[string]float64)
+			for _, elmScaleItem := range elmScaleItems {
+				values := make(map[string]float64)
+				for _, elmScaleItemValue := range elmScaleItem.ChildElements() {
+					elmValue := elmScaleItemValue.SelectAttrValue("value", "")
+					value, err := strconv.ParseFloat(elmValue, 64)
+					if err != nil || value <= 0 {
+						return nil, fmt.Errorf("invalid scale rate %s from %s to %s", elmValue, elmScaleItem.Tag, elmScaleItemValue.Tag)
+					}
+					values[elmScaleItemValue.Tag] = value
+				}
+				definitions.Scale.AggrRates[elmScaleItem.Tag] = values
 			}
-			items[elmScaleItem.Tag] = values
 		}
-		itemsByte, err := json.MarshalIndent(items, "", "  ")
+	}
+	return definitions, nil
+}
+
+func processBooleanPayload(element *etree.Element) *booleanDefinitions {
+	return &booleanDefinitions{
+		Display: element.SelectAttrValue("display", "checkbox"),
+	}
+}
+
+func processTextAreaPayload(element *etree.Element) (*textAreaDefinitions, error) {
+	definitions := &textAreaDefinitions{
+		Display: element.SelectAttrValue("display", "rich_text"),
+	}
+	if elmMaxLength := element.SelectAttr("maxLength"); elmMaxLength != nil {
+		maxLength, err := strconv.Atoi(elmMaxLength.Value)
+		if err != nil || maxLength <= 0 {
+			return nil, fmt.Errorf("invalid maxLength %s", elmMaxLength.Value)
+		}
+		definitions.MaxLength = maxLength
+	}
+	return definitions, nil
+}
+
+func processMoneyPayload(element *etree.Element) (*moneyDefinitions, error) {
+	elmCurrency := element.SelectAttrValue("currency", "")
+	elmDecimals := element.SelectAttrValue("decimals", "2")
+
+	// an update without the currency attribute keeps the currency of the field
+	if (element.SelectAttr("currency") != nil || element.Tag == "createField") && !currencyPattern.MatchString(elmCurrency) {
+		return nil, fmt.Errorf("field %s: invalid currency %s, expected an ISO 4217 code", element.SelectAttrValue("code", ""), elmCurrency)
+	}
+	decimals, err := strconv.Atoi(elmDecimals)
+	if err != nil {
+		return nil, fmt.Errorf("invalid decimals %s", elmDecimals)
+	}
+	return &moneyDefinitions{
+		Display:      element.SelectAttrValue("display", "money"),
+		CurrencyCode: elmCurrency,
+		Decimals:     decimals,
+	}, nil
+}
+
+func processPercentagePayload(element *etree.Element) (*percentageDefinitions, error) {
+	elmDecimals := element.SelectAttrValue("decimals", "0")
+
+	decimals, err := strconv.Atoi(elmDecimals)
+	if err != nil {
+		return nil, fmt.Errorf("invalid decimals %s", elmDecimals)
+	}
+	return &percentageDefinitions{
+		Display:  element.SelectAttrValue("display", "percentage"),
+		Decimals: decimals,
+	}, nil
+}
+
+func processAttachmentPayload(element *etree.Element) (*attachmentDefinitions, error) {
+	elmMaxFiles := element.SelectAttrValue("maxFiles", "1")
+	elmThumbnail := element.SelectAttrValue("thumbnail", "false")
+
+	definitions := &attachmentDefinitions{
+		Display: element.SelectAttrValue("display", "list"),
+	}
+	if elmMaxSize := element.SelectAttr("maxSize"); elmMaxSize != nil {
+		maxSize, err := parseSize(elmMaxSize.Value)
 		if err != nil {
-			return "", err
-		}
-		payloadAggRates = fmt.Sprintf(`,
-					"aggr_rates": %s
-				`, string(itemsByte))
-	}
-	if payloadDataset != "" {
-		payloadScale = fmt.Sprintf(`,
-				"scale": {
-					%s
-					%s
-				}`, payloadDataset, payloadAggRates)
-	}
-	payload = fmt.Sprintf(`{
-			%s,
-			"definitions": {
-				"display": "%s",
-				"decimals": %s
-				%s
-			}
-		}`, payload, elmDisplay, elmDecimals, payloadScale)
-	return payload, nil
-}
-
-func processDatePayload(element *etree.Element, payload string) string {
-	elmDisplay := element.SelectAttrValue("display", "date_time")
-	elmFormat := element.SelectAttrValue("format", "DD/MM/YYYY HH:MM")
-	payload = fmt.Sprintf(`{
-			%s,
-			"definitions": {
-				"display": "%s",
-				"format": "%s"
+			return nil, err
+		}
+		definitions.MaxSize = maxSize
+	}
+	maxFiles, err := strconv.Atoi(elmMaxFiles)
+	if err != nil || maxFiles <= 0 {
+		return nil, fmt.Errorf("invalid maxFiles %s", elmMaxFiles)
+	}
+	definitions.MaxFiles = maxFiles
+	definitions.Thumbnail, err = strconv.ParseBool(elmThumbnail)
+	if err != nil {
+		return nil, fmt.Errorf("invalid thumbnail %s", elmThumbnail)
+	}
+	if elmAccept := element.SelectElement("accept"); elmAccept != nil {
+		for _, elmMime := range elmAccept.SelectElements("mime") {
+			mimeType := elmMime.SelectAttrValue("type", "")
+			if !mimePattern.MatchString(mimeType) {
+				return nil, fmt.Errorf("invalid mime type %s", mimeType)
 			}
-		}`, payload, elmDisplay, elmFormat)
-	return payload
+			definitions.AcceptTypes = append(definitions.AcceptTypes, mimeType)
+		}
+	}
+	return definitions, nil
 }
 
-func processLookupPayload(x *xml, element *etree.Element, payload, path string) (string, error) {
-	elmDisplay := element.SelectAttrValue("display", "select_single")
-	elemDataset := element.SelectElement("dataset")
-	elmDatasetCode := elemDataset.SelectAttrValue("code", "")
-	elmLookupType := elemDataset.SelectAttrValue("type", "")
-	if elmLookupType == constants.FieldLookupStatic {
-		payload = fmt.Sprintf(`{
-				%s,
-				"definitions": {
-					"display": "%s",
-					"dataset_code": "%s",
-					"lookup_type": "%s"     
-				}
-			}`, payload, elmDisplay, elmDatasetCode, elmLookupType)
+func processFormulaPayload(element *etree.Element) (*formulaDefinitions, error) {
+	elmResultType := element.SelectAttrValue("resultType", constants.FieldNumber)
+	elmDecimals := element.SelectAttrValue("decimals", "0")
+	elmExpression := element.SelectElement("expression")
+
+	if !contains(formulaResultTypes, elmResultType) {
+		return nil, fmt.Errorf("invalid resultType %s", elmResultType)
+	}
+	decimals, err := strconv.Atoi(elmDecimals)
+	if err != nil {
+		return nil, fmt.Errorf("invalid decimals %s", elmDecimals)
+	}
+	definitions := &formulaDefinitions{
+		Display:    element.SelectAttrValue("display", "readonly"),
+		ResultType: elmResultType,
+		Decimals:   decimals,
+	}
+	if elmExpression == nil {
+		return definitions, nil
+	}
+	definitions.Expression = strings.TrimSpace(elmExpression.Text())
+	definitions.Dependencies, err = parseFormula(definitions.Expression)
+	if err != nil {
+		return nil, fmt.Errorf("field %s: invalid expression: %s", element.SelectAttrValue("code", ""), err.Error())
+	}
+	return definitions, nil
+}
+
+// fieldValueTypes maps the field types accepting a default value to the value type it is cast to,
+// date fields are cast by their display instead
+var fieldValueTypes = map[string]string{
+	constants.FieldText:   valueString,
+	constants.FieldNumber: valueDecimal,
+	constants.FieldDate:   valueDatetime,
+	constants.FieldLookup: valueString,
+	fieldBoolean:          valueBoolean,
+	fieldTextArea:         valueString,
+	fieldMoney:            valueDecimal,
+	fieldPercentage:       valueDecimal,
+}
+
+// dateValueTypes maps the displays of a date field to the value type its default is cast to
+var dateValueTypes = map[string]string{
+	dateDisplayDate:     valueDate,
+	dateDisplayTime:     valueTime,
+	dateDisplayDateTime: valueDatetime,
+}
+
+// defaultExpressions lists the field types accepting each default expression
+var defaultExpressions = map[string][]string{
+	"{{now}}":          {constants.FieldDate},
+	"{{today}}":        {constants.FieldDate},
+	"{{current_user}}": {constants.FieldText, constants.FieldLookup},
+}
+
+// dateDefaultExpressions lists the date displays accepting each default expression of a date field
+var dateDefaultExpressions = map[string][]string{
+	"{{now}}":   {dateDisplayTime, dateDisplayDateTime},
+	"{{today}}": {dateDisplayDate, dateDisplayDateTime},
+}
+
+func processFieldDefault(element *etree.Element, fieldType string) (fieldDefault, error) {
+	value := fieldDefault{}
+	elmDefault := element.SelectAttr("default")
+	elmExpression := element.SelectElement("default")
+	if elmDefault == nil && elmExpression == nil {
+		return value, nil
+	}
+	if elmDefault != nil && elmExpression != nil {
+		return value, fmt.Errorf("default must be set either by the attribute or by the element")
+	}
+	var err error
+	elmDisplay := element.SelectAttrValue("display", dateDisplayDateTime)
+	if elmDefault != nil {
+		value.Default, err = parseDefaultValue(fieldType, elmDisplay, elmDefault.Value)
 	} else {
-		elmLookupLabel := elemDataset.SelectAttrValue("lookup_label", "name")
-		elmLookupValue := elemDataset.SelectAttrValue("lookup_value", "code")
-		elmFields := elemDataset.SelectElement("fields").SelectElements("field")
-		elmGroups := elemDataset.SelectElement("groups")
-		fields := []map[string]interface{}{}
-		params := []map[string]interface{}{}
-		payloadSecurityGroups := ""
-		if elmGroups != nil {
-			payloadSecurityGroups = fmt.Sprintf(`, "security_groups": ["%s"]`, strings.Join(strings.Split(strings.Trim(elmGroups.Text(), " \n\r"), ","), `","`))
-		}
-		for _, elmField := range elmFields {
-			field := make(map[string]interface{})
-			code := elmField.SelectAttrValue("code", "")
-			name := elmField.SelectAttrValue("name", "")
-
-			pathField := fmt.Sprintf("%s/fields/field[@code='%s']", path, code)
-			if err := x.processTranslation(pathField, "name", &name); err != nil {
-				return "", err
-			}
+		value.DefaultExpression, err = parseDefaultExpression(fieldType, elmDisplay, elmExpression.Text())
+	}
+	return value, err
+}
 
-			field["code"] = code
-			field["label"] = (json.RawMessage)([]byte(name))
-			elmFilter := elmField.SelectElement("filter")
-			if elmFilter != nil {
-				filter := make(map[string]interface{})
-				filter["value_type"] = elmFilter.SelectAttrValue("type", "")
-				filter["value"] = castToValueType(elmFilter.SelectAttrValue("value", ""), elmFilter.SelectAttrValue("valueType", "string"))
-				filter["operator"] = elmFilter.SelectAttrValue("operator", "")
-				filter["readonly"], _ = strconv.ParseBool(elmFilter.SelectAttrValue("readonly", "false"))
-				field["filter"] = filter
-			}
-			fields = append(fields, field)
+// parseDefaultValue casts a default value to the value type of the field and its display mode
+func parseDefaultValue(fieldType, display, value string) (interface{}, error) {
+	valueType, ok := fieldValueTypes[fieldType]
+	if !ok {
+		return nil, fmt.Errorf("%s fields do not accept a default value", fieldType)
+	}
+	if dateType, ok := dateValueTypes[display]; ok && fieldType == constants.FieldDate {
+		valueType = dateType
+	}
+	result, err := castValue(value, valueType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid default: %s", err.Error())
+	}
+	return result, nil
+}
+
+// parseDefaultExpression checks a default expression applies to the field type and, for date fields, to its display mode
+func parseDefaultExpression(fieldType, display, expression string) (string, error) {
+	expression = strings.TrimSpace(expression)
+	types, ok := defaultExpressions[expression]
+	if !ok {
+		return "", fmt.Errorf("unknown default expression %s, expected one of %s", expression, strings.Join(sortedKeys(defaultExpressions), ", "))
+	}
+	if !contains(types, fieldType) {
+		return "", fmt.Errorf("default expression %s does not apply to %s fields", expression, fieldType)
+	}
+	if displays, ok := dateDefaultExpressions[expression]; ok && fieldType == constants.FieldDate && !contains(displays, display) {
+		return "", fmt.Errorf("default expression %s does not apply to the %s display, expected one of %s", expression, display, strings.Join(displays, ", "))
+	}
+	return expression, nil
+}
+
+// validationTypes lists the field types accepting each validation rule
+var validationTypes = map[string][]string{
+	"required":  {constants.FieldText, constants.FieldNumber, constants.FieldDate, constants.FieldLookup, fieldBoolean, fieldTextArea, fieldMoney, fieldPercentage, fieldAttachment},
+	"unique":    {constants.FieldText, constants.FieldNumber, constants.FieldDate, fieldMoney, fieldPercentage},
+	"min":       {constants.FieldNumber, constants.FieldDate, fieldMoney, fieldPercentage},
+	"max":       {constants.FieldNumber, constants.FieldDate, fieldMoney, fieldPercentage},
+	"minLength": {constants.FieldText, fieldTextArea},
+	"maxLength": {constants.FieldText, fieldTextArea},
+	"pattern":   {constants.FieldText, fieldTextArea},
+}
+
+func processFieldValidations(element *etree.Element, fieldType string) (*fieldValidations, error) {
+	elmValidation := element.SelectElement("validation")
+	if elmValidation == nil {
+		return nil, nil
+	}
+	validations, err := parseFieldValidations(fieldType, elementAttrs(elmValidation))
+	if err != nil {
+		return nil, fmt.Errorf("field %s: %s", element.SelectAttrValue("code", ""), err.Error())
+	}
+	return validations, nil
+}
+
+// parseFieldValidations checks that the rules of a validation element apply to the field type and are consistent
+func parseFieldValidations(fieldType string, attrs map[string]string) (*fieldValidations, error) {
+	validations := &fieldValidations{}
+	for _, rule := range sortedKeys(attrs) {
+		if types, ok := validationTypes[rule]; ok && !contains(types, fieldType) {
+			return nil, fmt.Errorf("validation %s does not apply to %s fields", rule, fieldType)
+		}
+	}
+
+	var err error
+	if value, ok := attrs["required"]; ok {
+		if validations.Required, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("invalid required %s", value)
+		}
+	}
+	if value, ok := attrs["unique"]; ok {
+		if validations.Unique, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("invalid unique %s", value)
+		}
+	}
+	if validations.MinLength, err = validationLength(attrs, "minLength"); err != nil {
+		return nil, err
+	}
+	if validations.MaxLength, err = validationLength(attrs, "maxLength"); err != nil {
+		return nil, err
+	}
+	if validations.MinLength != nil && validations.MaxLength != nil && *validations.MinLength > *validations.MaxLength {
+		return nil, fmt.Errorf("minLength %d is greater than maxLength %d", *validations.MinLength, *validations.MaxLength)
+	}
+	if value, ok := attrs["pattern"]; ok {
+		if _, err := regexp.Compile(value); err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %s", value, err.Error())
+		}
+		validations.Pattern = value
+	}
+
+	if fieldType == constants.FieldDate {
+		return validations, validationDateRange(validations, attrs)
+	}
+	return validations, validationNumberRange(validations, attrs)
+}
+
+func validationLength(attrs map[string]string, rule string) (*int, error) {
+	value, ok := attrs[rule]
+	if !ok {
+		return nil, nil
+	}
+	length, err := strconv.Atoi(value)
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid %s %s", rule, value)
+	}
+	return &length, nil
+}
+
+func validationNumberRange(validations *fieldValidations, attrs map[string]string) error {
+	limits := make(map[string]float64)
+	for _, rule := range []string{"min", "max"} {
+		value, ok := attrs[rule]
+		if !ok {
+			continue
 		}
-		fieldsByte, err := json.MarshalIndent(fields, "", "  ")
+		limit, err := strconv.ParseFloat(value, 64)
 		if err != nil {
-			return "", err
-		}
-		payloadParams := ""
-		elmParamsAgg := elemDataset.SelectElement("params")
-		if elmParamsAgg != nil {
-			elmParams := elmParamsAgg.SelectElements("param")
-			for _, elmParam := range elmParams {
-				param := make(map[string]interface{})
-				param["code"] = elmParam.SelectAttrValue("code", "")
-				param["value_type"] = elmParam.SelectAttrValue("type", "")
-				param["value"] = castToValueType(elmParam.SelectAttrValue("value", ""), elmParam.SelectAttrValue("valueType", "string"))
-				params = append(params, param)
-			}
-			paramsByte, err := json.MarshalIndent(params, "", "  ")
-			if err != nil {
-				return "", err
+			return fmt.Errorf("invalid %s %s, expected a number", rule, value)
+		}
+		limits[rule] = limit
+	}
+	if min, ok := limits["min"]; ok {
+		validations.Min = min
+	}
+	if max, ok := limits["max"]; ok {
+		validations.Max = max
+	}
+	if _, ok := limits["min"]; ok && validations.Max != nil && limits["min"] > limits["max"] {
+		return fmt.Errorf("min %s is greater than max %s", attrs["min"], attrs["max"])
+	}
+	return nil
+}
+
+// validationDateRange accepts dates as YYYY-MM-DD or RFC 3339 timestamps
+func validationDateRange(validations *fieldValidations, attrs map[string]string) error {
+	limits := make(map[string]time.Time)
+	for _, rule := range []string{"min", "max"} {
+		value, ok := attrs[rule]
+		if !ok {
+			continue
+		}
+		limit, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			if limit, err = time.Parse(time.RFC3339, value); err != nil {
+				return fmt.Errorf("invalid %s %s, expected a date as YYYY-MM-DD or RFC 3339", rule, value)
 			}
-			payloadParams = fmt.Sprintf(`, "lookup_params": %s`, string(paramsByte))
-		}
-		payload = fmt.Sprintf(`{
-				%s,
-				"definitions": {
-					"display": "%s",
-					"dataset_code": "%s",
-					"lookup_type": "%s",
-					"lookup_label": "%s",
-					"lookup_value": "%s",
-					"lookup_fields": %s
-					%s
-					%s
-				}
-			}`, payload, elmDisplay, elmDatasetCode, elmLookupType, elmLookupLabel, elmLookupValue, string(fieldsByte), payloadParams, payloadSecurityGroups)
+		}
+		limits[rule] = limit
+	}
+	if _, ok := limits["min"]; ok {
+		validations.Min = attrs["min"]
+	}
+	if _, ok := limits["max"]; ok {
+		validations.Max = attrs["max"]
 	}
-	return payload, nil
+	if min, ok := limits["min"]; ok && validations.Max != nil && min.After(limits["max"]) {
+		return fmt.Errorf("min %s is after max %s", attrs["min"], attrs["max"])
+	}
+	return nil
+}
+
+// parseSize returns the number of bytes of a size written as an integer optionally followed by B, KB, MB or GB
+func parseSize(value string) (int64, error) {
+	matches := sizePattern.FindStringSubmatch(value)
+	if matches == nil {
+		return 0, fmt.Errorf("invalid size %s", value)
+	}
+	size, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid size %s", value)
+	}
+	return size * sizeUnits[matches[2]], nil
+}
+
+// lookupDefaults are the label and value used when a lookup dataset does not set them
+var lookupDefaults = map[string]string{
+	"label": "name",
+	"value": "code",
 }
 
-func castToValueType(value, valueType string) interface{} {
-	var result interface{}
-	switch valueType {
-	case "string":
-		result = value
-	case "number":
-		result, _ = strconv.ParseInt(value, 0, 0)
-	case "boolean":
-		result, _ = strconv.ParseBool(value)
+// lookupAttribute returns the label or value of a lookup dataset, accepting the legacy lookup_ spelling, and checks it is one of the field codes
+func lookupAttribute(attrs map[string]string, attr string, codes []string) (string, bool, error) {
+	legacyAttr := "lookup_" + attr
+	value, ok := attrs[attr]
+	legacyValue, legacy := attrs[legacyAttr]
+	if ok && legacy && value != legacyValue {
+		return "", false, fmt.Errorf("%s %s and %s %s disagree, remove the deprecated %s", attr, value, legacyAttr, legacyValue, legacyAttr)
+	}
+	if !ok {
+		value = lookupDefaults[attr]
+		if legacy {
+			value = legacyValue
+		}
+	}
+	if !contains(codes, value) {
+		return "", false, fmt.Errorf("lookup %s %s is not one of the fields %s", attr, value, strings.Join(codes, ", "))
+	}
+	return value, legacy && !ok, nil
+}
+
+func processDatePayload(x *xml, element *etree.Element) (*dateDefinitions, error) {
+	elmDisplay := element.SelectAttrValue("display", dateDisplayDateTime)
+	elmFormat := element.SelectAttrValue("format", defaultDateFormat(x.LanguageCode, elmDisplay))
+	elmTimezone := element.SelectAttrValue("timezone", timezoneUser)
+
+	if err := parseDateFormat(elmFormat, elmDisplay); err != nil {
+		return nil, fmt.Errorf("field %s: %s", element.SelectAttrValue("code", ""), err.Error())
+	}
+	if err := parseTimezone(elmTimezone); err != nil {
+		return nil, fmt.Errorf("field %s: %s", element.SelectAttrValue("code", ""), err.Error())
+	}
+	return &dateDefinitions{
+		Display:  elmDisplay,
+		Format:   elmFormat,
+		Timezone: elmTimezone,
+	}, nil
+}
+
+func processLookupPayload(x *xml, element *etree.Element, path string) (*lookupDefinitions, error) {
+	elemDataset := element.SelectElement("dataset")
+	definitions := &lookupDefinitions{
+		Display: element.SelectAttrValue("display", "select_single"),
+	}
+	if elemDataset == nil {
+		return definitions, nil
+	}
+	definitions.DatasetCode = elemDataset.SelectAttrValue("code", "")
+	definitions.LookupType = elemDataset.SelectAttrValue("type", "")
+	if definitions.LookupType == constants.FieldLookupStatic {
+		return definitions, nil
+	}
+
+	elmFieldsAgg := elemDataset.SelectElement("fields")
+	if elmFieldsAgg == nil {
+		return nil, fmt.Errorf("field %s: %s lookup on dataset %s requires a fields element", element.SelectAttrValue("code", ""), definitions.LookupType, definitions.DatasetCode)
+	}
+	elmFields := elmFieldsAgg.SelectElements("field")
+	codes := []string{}
+	for _, elmField := range elmFields {
+		codes = append(codes, elmField.SelectAttrValue("code", ""))
+	}
+	attrs := elementAttrs(elemDataset)
+	for _, attr := range []string{"label", "value"} {
+		value, legacy, err := lookupAttribute(attrs, attr, codes)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %s", element.SelectAttrValue("code", ""), err.Error())
+		}
+		if legacy {
+			fmt.Printf("Warning: %s/dataset: lookup_%s is deprecated, use %s\n", path, attr, attr)
+		}
+		if attr == "label" {
+			definitions.LookupLabel = value
+		} else {
+			definitions.LookupValue = value
+		}
+	}
+	definitions.LookupFields = []lookupField{}
+	elmGroups := elemDataset.SelectElement("groups")
+	if elmGroups != nil {
+		definitions.SecurityGroups = strings.Split(strings.Trim(elmGroups.Text(), " \n\r"), ",")
+	}
+	for _, elmField := range elmFields {
+		code := elmField.SelectAttrValue("code", "")
+		name := elmField.SelectAttrValue("name", "")
+
+		pathField := fmt.Sprintf("%s/fields/field[@code='%s']", path, code)
+		field := lookupField{
+			Code:  code,
+			Label: x.processTranslation(pathField, "name", name),
+		}
+		elmFilter := elmField.SelectElement("filter")
+		if elmFilter != nil {
+			value, err := castElementValue(elmFilter, pathField+"/filter")
+			if err != nil {
+				return nil, err
+			}
+			field.Filter = &lookupFilter{
+				ValueType: elmFilter.SelectAttrValue("type", ""),
+				Value:     value,
+				Operator:  elmFilter.SelectAttrValue("operator", ""),
+			}
+			field.Filter.Readonly, _ = strconv.ParseBool(elmFilter.SelectAttrValue("readonly", "false"))
+		}
+		definitions.LookupFields = append(definitions.LookupFields, field)
+	}
+	elmParamsAgg := elemDataset.SelectElement("params")
+	if elmParamsAgg != nil {
+		for _, elmParam := range elmParamsAgg.SelectElements("param") {
+			code := elmParam.SelectAttrValue("code", "")
+			value, err := castElementValue(elmParam, fmt.Sprintf("%s/params/param[@code='%s']", path, code))
+			if err != nil {
+				return nil, err
+			}
+			definitions.LookupParams = append(definitions.LookupParams, lookupParam{
+				Code:      code,
+				ValueType: elmParam.SelectAttrValue("type", ""),
+				Value:     value,
+			})
+		}
 	}
-	return result
+	return definitions, nil
 }
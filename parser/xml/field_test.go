@@ -0,0 +1,149 @@
+package xml
+
+import (
+	"strings"
+	"testing"
+)
+
+// findTask returns the task generated for an element type and code
+func findTask(t *testing.T, x *xml, taskType, code string) task {
+	t.Helper()
+	for _, task := range x.Tasks {
+		if task.Type == taskType && task.Code == code {
+			return task
+		}
+	}
+	t.Fatalf("task %s %s not found", taskType, code)
+	return task{}
+}
+
+func TestUpdateMoneyFieldCurrency(t *testing.T) {
+	tests := []struct {
+		name     string
+		currency string
+		// violation is the expected validate and parse error, empty when the update is valid
+		violation string
+		// expected is the currency_code sent in the definitions, empty when the definitions are left out
+		expected string
+	}{
+		{name: "currency kept when absent"},
+		{name: "currency changed", currency: ` currency="EUR"`, expected: "EUR"},
+		{name: "invalid currency", currency: ` currency="eur"`, violation: "invalid currency eur, expected an ISO 4217 code"},
+		{name: "empty currency", currency: ` currency=""`, violation: "invalid currency , expected an ISO 4217 code"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			module := testModule(`<task:createSchema code="tasks" name="Tasks" />
+      <task:updateField schemaCode="sys_mdl_tst_tasks" code="cost" type="money" name="Cost"` + test.currency + ` />`)
+			expected := []expectedViolation{}
+			if test.violation != "" {
+				expected = append(expected, expectedViolation{6, "task:updateField: " + test.violation})
+			}
+			checkViolations(t, module, Options{}, expected)
+
+			x, err := parse(writeModule(t, module), "", Options{})
+			if test.violation != "" {
+				if err == nil || !strings.Contains(err.Error(), test.violation) {
+					t.Errorf("expected parse error %s, found %v", test.violation, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %s", err.Error())
+			}
+			definitions := findTask(t, x, "updateField", "cost").ExecPayload.(fieldUpdatePayload).Definitions
+			if test.expected == "" {
+				if _, ok := definitions["currency_code"]; ok {
+					t.Errorf("expected no currency_code, found %v", definitions)
+				}
+			} else if definitions["currency_code"] != test.expected {
+				t.Errorf("expected currency_code %s, found %v", test.expected, definitions)
+			}
+		})
+	}
+}
+
+func TestCreateMoneyFieldCurrency(t *testing.T) {
+	xmlFile := writeModule(t, testModule(`<task:createSchema code="tasks" name="Tasks">
+        <task:createField schemaCode="sys_mdl_tst_tasks" code="cost" type="money" name="Cost" />
+      </task:createSchema>`))
+	violations, err := Validate(xmlFile, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 1 || !strings.Contains(violations[0].Message, "money field requires the currency attribute") {
+		t.Errorf("expected the missing currency violation, found %v", violations)
+	}
+}
+
+func TestDateFieldDefault(t *testing.T) {
+	tests := []struct {
+		name    string
+		display string
+		// value is the default attribute, expression the default element when value is empty
+		value      string
+		expression string
+		violation  string
+	}{
+		{name: "date", display: "date", value: "2024-02-29"},
+		{name: "date with a datetime", display: "date", value: "2024-02-29T10:00:00Z", violation: `"2024-02-29T10:00:00Z" is not a date as YYYY-MM-DD`},
+		{name: "date today", display: "date", expression: "{{today}}"},
+		{name: "date now", display: "date", expression: "{{now}}", violation: "default expression {{now}} does not apply to the date display"},
+		{name: "time", display: "time", value: "14:30"},
+		{name: "time with seconds", display: "time", value: "14:30:15"},
+		{name: "time out of range", display: "time", value: "25:00", violation: `"25:00" is not a time as HH:MM or HH:MM:SS`},
+		{name: "time with a datetime", display: "time", value: "2024-02-29T14:30:00Z", violation: "is not a time as HH:MM or HH:MM:SS"},
+		{name: "time now", display: "time", expression: "{{now}}"},
+		{name: "time today", display: "time", expression: "{{today}}", violation: "default expression {{today}} does not apply to the time display"},
+		{name: "date_time", display: "date_time", value: "2024-02-29T14:30:00-03:00"},
+		{name: "date_time with a date", display: "date_time", value: "2024-02-29", violation: `"2024-02-29" is not a datetime as RFC 3339`},
+		{name: "date_time now", display: "date_time", expression: "{{now}}"},
+		{name: "date_time today", display: "date_time", expression: "{{today}}"},
+		{name: "no display", value: "2024-02-29T14:30:00Z"},
+		{name: "no display with a time", value: "14:30", violation: `"14:30" is not a datetime as RFC 3339`},
+		{name: "no display now", expression: "{{now}}"},
+		{name: "no display current user", expression: "{{current_user}}", violation: "default expression {{current_user}} does not apply to date fields"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attrs := ""
+			if test.display != "" {
+				attrs += ` display="` + test.display + `"`
+			}
+			field := `<task:createField schemaCode="sys_mdl_tst_tasks" type="date" code="due" name="Due"` + attrs + ` default="` + test.value + `" />`
+			line := 6
+			if test.value == "" {
+				field = `<task:createField schemaCode="sys_mdl_tst_tasks" type="date" code="due" name="Due"` + attrs + `>
+          <default>` + test.expression + `</default>
+        </task:createField>`
+				line = 7
+			}
+			module := testModule(`<task:createSchema code="tasks" name="Tasks">
+        ` + field + `
+      </task:createSchema>`)
+			expected := []expectedViolation{}
+			if test.violation != "" {
+				expected = append(expected, expectedViolation{line, test.violation})
+			}
+			checkViolations(t, module, Options{}, expected)
+
+			x, err := parse(writeModule(t, module), "", Options{})
+			if test.violation != "" {
+				if err == nil || !strings.Contains(err.Error(), test.violation) {
+					t.Errorf("expected parse error %s, found %v", test.violation, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %s", err.Error())
+			}
+			definitions := findTask(t, x, "createField", "due").ExecPayload.(fieldPayload).Definitions.(*dateDefinitions)
+			if test.value != "" && definitions.Default != test.value {
+				t.Errorf("expected default %s, found %v", test.value, definitions.Default)
+			}
+			if definitions.DefaultExpression != test.expression {
+				t.Errorf("expected default expression %s, found %s", test.expression, definitions.DefaultExpression)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package xml
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/agile-work/srv-shared/constants"
+)
+
+// formulaResultTypes are the value types a formula field may produce
+var formulaResultTypes = []string{constants.FieldNumber, constants.FieldDate, constants.FieldText}
+
+// formulaFunctions are the functions accepted in a formula expression
+var formulaFunctions = []string{"abs", "round", "floor", "ceil", "min", "max", "coalesce", "now"}
+
+// Token kinds produced by the formula tokenizer
+const (
+	tokenIdentifier = "identifier"
+	tokenNumber     = "number"
+	tokenString     = "string"
+	tokenOperator   = "operator"
+	tokenEnd        = "end"
+)
+
+type formulaToken struct {
+	Kind     string
+	Value    string
+	Position int
+}
+
+// tokenizeFormula splits an expression into identifiers, numbers, quoted strings and operators
+func tokenizeFormula(expression string) ([]formulaToken, error) {
+	tokens := []formulaToken{}
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '_' || unicode.IsLetter(r):
+			for i < len(runes) && (runes[i] == '_' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, formulaToken{Kind: tokenIdentifier, Value: string(runes[start:i]), Position: start + 1})
+		case unicode.IsDigit(r):
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			value := string(runes[start:i])
+			if strings.Count(value, ".") > 1 || strings.HasSuffix(value, ".") {
+				return nil, fmt.Errorf("invalid number %s at position %d", value, start+1)
+			}
+			tokens = append(tokens, formulaToken{Kind: tokenNumber, Value: value, Position: start + 1})
+		case r == '\'':
+			i++
+			for i < len(runes) && runes[i] != '\'' {
+				i++
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d", start+1)
+			}
+			i++
+			tokens = append(tokens, formulaToken{Kind: tokenString, Value: string(runes[start+1 : i-1]), Position: start + 1})
+		case strings.ContainsRune("+-*/%(),", r):
+			i++
+			tokens = append(tokens, formulaToken{Kind: tokenOperator, Value: string(r), Position: start + 1})
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", r, start+1)
+		}
+	}
+	return append(tokens, formulaToken{Kind: tokenEnd, Position: len(runes) + 1}), nil
+}
+
+// formulaParser checks the expression grammar and collects the field codes it references
+type formulaParser struct {
+	Tokens       []formulaToken
+	Index        int
+	Dependencies []string
+}
+
+// parseFormula returns the field codes referenced by an expression in order of appearance
+func parseFormula(expression string) ([]string, error) {
+	tokens, err := tokenizeFormula(expression)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 1 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	p := &formulaParser{Tokens: tokens, Dependencies: []string{}}
+	if err := p.expression(); err != nil {
+		return nil, err
+	}
+	if token := p.peek(); token.Kind != tokenEnd {
+		return nil, fmt.Errorf("unexpected %s at position %d", token.Value, token.Position)
+	}
+	return p.Dependencies, nil
+}
+
+func (p *formulaParser) peek() formulaToken {
+	return p.Tokens[p.Index]
+}
+
+func (p *formulaParser) next() formulaToken {
+	token := p.Tokens[p.Index]
+	if token.Kind != tokenEnd {
+		p.Index++
+	}
+	return token
+}
+
+func (p *formulaParser) operator(values string) bool {
+	token := p.peek()
+	return token.Kind == tokenOperator && strings.Contains(values, token.Value)
+}
+
+func (p *formulaParser) expect(value string) error {
+	if !p.operator(value) {
+		token := p.peek()
+		if token.Kind == tokenEnd {
+			return fmt.Errorf("expected %s at end of expression", value)
+		}
+		return fmt.Errorf("expected %s at position %d, found %s", value, token.Position, token.Value)
+	}
+	p.next()
+	return nil
+}
+
+func (p *formulaParser) expression() error {
+	if err := p.term(); err != nil {
+		return err
+	}
+	for p.operator("+-") {
+		p.next()
+		if err := p.term(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *formulaParser) term() error {
+	if err := p.unary(); err != nil {
+		return err
+	}
+	for p.operator("*/%") {
+		p.next()
+		if err := p.unary(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *formulaParser) unary() error {
+	if p.operator("-") {
+		p.next()
+		return p.unary()
+	}
+	return p.primary()
+}
+
+func (p *formulaParser) primary() error {
+	token := p.next()
+	switch token.Kind {
+	case tokenNumber, tokenString:
+		return nil
+	case tokenIdentifier:
+		if !p.operator("(") {
+			if !contains(p.Dependencies, token.Value) {
+				p.Dependencies = append(p.Dependencies, token.Value)
+			}
+			return nil
+		}
+		if !contains(formulaFunctions, token.Value) {
+			return fmt.Errorf("unknown function %s at position %d", token.Value, token.Position)
+		}
+		p.next()
+		if p.operator(")") {
+			p.next()
+			return nil
+		}
+		for {
+			if err := p.expression(); err != nil {
+				return err
+			}
+			if !p.operator(",") {
+				return p.expect(")")
+			}
+			p.next()
+		}
+	case tokenOperator:
+		if token.Value == "(" {
+			if err := p.expression(); err != nil {
+				return err
+			}
+			return p.expect(")")
+		}
+		return fmt.Errorf("unexpected %s at position %d", token.Value, token.Position)
+	}
+	return fmt.Errorf("unexpected end of expression")
+}
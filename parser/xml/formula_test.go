@@ -0,0 +1,142 @@
+package xml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFormula(t *testing.T) {
+	tests := []struct {
+		expression   string
+		dependencies []string
+		err          string
+	}{
+		{expression: "effort * rate", dependencies: []string{"effort", "rate"}},
+		{expression: "round((effort + extra) / 8, 2) - effort", dependencies: []string{"effort", "extra"}},
+		{expression: "-coalesce(discount, 0) % 10", dependencies: []string{"discount"}},
+		{expression: "max(start_date, now())", dependencies: []string{"start_date"}},
+		{expression: "'fixed text'", dependencies: []string{}},
+		{expression: "1.5 * 2", dependencies: []string{}},
+		{expression: "", err: "empty expression"},
+		{expression: "   ", err: "empty expression"},
+		{expression: "effort * 1.2.3", err: "invalid number 1.2.3 at position 10"},
+		{expression: "effort * 2.", err: "invalid number 2. at position 10"},
+		{expression: "name + 'open", err: "unterminated string at position 8"},
+		{expression: "effort > 1", err: `unexpected character '>' at position 8`},
+		{expression: "effort rate", err: "unexpected rate at position 8"},
+		{expression: "effort *", err: "unexpected end of expression"},
+		{expression: "* effort", err: "unexpected * at position 1"},
+		{expression: "(effort + 1", err: "expected ) at end of expression"},
+		{expression: "round(effort 2)", err: "expected ) at position 14, found 2"},
+		{expression: "sqrt(effort)", err: "unknown function sqrt at position 1"},
+	}
+	for _, test := range tests {
+		dependencies, err := parseFormula(test.expression)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%q: expected error %s, found %v", test.expression, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %s", test.expression, err.Error())
+			continue
+		}
+		if strings.Join(dependencies, ",") != strings.Join(test.dependencies, ",") {
+			t.Errorf("%q: expected dependencies %v, found %v", test.expression, test.dependencies, dependencies)
+		}
+	}
+}
+
+func TestValidateFormulas(t *testing.T) {
+	formula := func(code, expression string) string {
+		return `<task:createField schemaCode="sys_mdl_tst_tasks" type="formula" code="` + code + `" name="` + code + `">
+          <expression>` + expression + `</expression>
+        </task:createField>`
+	}
+	schema := func(fields ...string) string {
+		return `<task:createSchema code="tasks" name="Tasks">
+        <task:createField schemaCode="sys_mdl_tst_tasks" type="number" code="effort" name="Effort" />
+        ` + strings.Join(fields, "\n        ") + `
+      </task:createSchema>`
+	}
+	tests := []struct {
+		name     string
+		tasks    string
+		expected []expectedViolation
+	}{
+		{
+			name:  "valid formulas",
+			tasks: schema(formula("cost", "effort * 10"), formula("total", "round(cost + effort, 2)")),
+		},
+		{
+			name:     "unknown field",
+			tasks:    schema(formula("cost", "effort * rate")),
+			expected: []expectedViolation{{7, "task:createField: field rate is not defined in schema sys_mdl_tst_tasks"}},
+		},
+		{
+			name: "field of another schema",
+			tasks: schema(formula("cost", "effort * rate")) + `<task:createSchema code="rates" name="Rates">
+        <task:createField schemaCode="sys_mdl_tst_rates" type="number" code="rate" name="Rate" />
+      </task:createSchema>`,
+			expected: []expectedViolation{{7, "field rate is not defined in schema sys_mdl_tst_tasks"}},
+		},
+		{
+			name:     "invalid expression",
+			tasks:    schema(formula("cost", "effort *")),
+			expected: []expectedViolation{{7, "task:createField: invalid expression: unexpected end of expression"}},
+		},
+		{
+			name:     "unknown function",
+			tasks:    schema(formula("cost", "sqrt(effort)")),
+			expected: []expectedViolation{{7, "invalid expression: unknown function sqrt at position 1"}},
+		},
+		{
+			name:     "self reference",
+			tasks:    schema(formula("cost", "cost + effort")),
+			expected: []expectedViolation{{7, "task:createField: formula cycle cost -> cost"}},
+		},
+		{
+			name:     "cycle",
+			tasks:    schema(formula("cost", "total - effort"), formula("total", "cost + effort")),
+			expected: []expectedViolation{{10, "task:createField: formula cycle cost -> total -> cost"}},
+		},
+		{
+			name: "invalid result type",
+			tasks: schema(`<task:createField schemaCode="sys_mdl_tst_tasks" type="formula" code="cost" name="Cost" resultType="boolean">
+          <expression>effort * 10</expression>
+        </task:createField>`),
+			expected: []expectedViolation{{7, "resultType"}},
+		},
+		{
+			name:     "missing expression",
+			tasks:    schema(`<task:createField schemaCode="sys_mdl_tst_tasks" type="formula" code="cost" name="Cost" />`),
+			expected: []expectedViolation{{7, "task:createField: formula field requires exactly one expression element"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkViolations(t, testModule(test.tasks), Options{}, test.expected)
+		})
+	}
+}
+
+func TestFormulaPayload(t *testing.T) {
+	x, err := parse(writeModule(t, testModule(`<task:createSchema code="tasks" name="Tasks">
+        <task:createField schemaCode="sys_mdl_tst_tasks" type="number" code="effort" name="Effort" />
+        <task:createField schemaCode="sys_mdl_tst_tasks" type="formula" code="cost" name="Cost" decimals="2">
+          <expression>
+            effort * 10
+          </expression>
+        </task:createField>
+      </task:createSchema>`)), "", Options{})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	payload := findTask(t, x, "createField", "cost").ExecPayload.(fieldPayload)
+	definitions := payload.Definitions.(*formulaDefinitions)
+	if definitions.Expression != "effort * 10" || definitions.ResultType != "number" || definitions.Decimals != 2 ||
+		strings.Join(definitions.Dependencies, ",") != "effort" {
+		t.Errorf("unexpected formula definitions %+v", definitions)
+	}
+}
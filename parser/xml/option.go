@@ -0,0 +1,175 @@
+package xml
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// optionAttributes are the option attributes a options file may set besides the names
+var optionAttributes = []string{"code", "name", "active", "color", "icon", "order", "parent"}
+
+var languagePattern = regexp.MustCompile(`^[a-z]{2}(-[a-z]{2})?$`)
+
+// fileOption is an option read from the file of a options src attribute
+type fileOption struct {
+	Source string
+	Attrs  map[string]string
+	Names  map[string]string
+}
+
+// loadOptionFile reads the options of a csv or json file, the name in the module language is set as the name attribute
+func loadOptionFile(fileName, languageCode string) ([]fileOption, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var options []fileOption
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		options, err = readOptionsCSV(file, filepath.Base(fileName))
+	case ".json":
+		options, err = readOptionsJSON(file, filepath.Base(fileName))
+	default:
+		return nil, fmt.Errorf("options file %s must be a csv or json file", fileName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, option := range options {
+		if name, ok := option.Attrs["name"]; ok {
+			if text, ok := option.Names[languageCode]; ok && text != name {
+				return nil, fmt.Errorf("%s: name %s and %s %s disagree", option.Source, name, languageCode, text)
+			}
+			option.Names[languageCode] = name
+		}
+		if name, ok := option.Names[languageCode]; ok {
+			option.Attrs["name"] = name
+		}
+	}
+	return options, nil
+}
+
+// readOptionsCSV reads a csv whose header has the option attributes and a column for each language name
+func readOptionsCSV(r io.Reader, source string) ([]fileOption, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	lines, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", source, err.Error())
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("%s: missing header", source)
+	}
+	header := lines[0]
+	for _, column := range header {
+		if !contains(optionAttributes, column) && !languagePattern.MatchString(column) {
+			return nil, fmt.Errorf("%s: unknown column %s, expected an option attribute or a language code", source, column)
+		}
+	}
+
+	options := []fileOption{}
+	for index, line := range lines[1:] {
+		option := fileOption{
+			Source: fmt.Sprintf("%s:%d", source, index+2),
+			Attrs:  make(map[string]string),
+			Names:  make(map[string]string),
+		}
+		for i, value := range line {
+			if value == "" {
+				continue
+			}
+			if contains(optionAttributes, header[i]) {
+				option.Attrs[header[i]] = value
+			} else {
+				option.Names[header[i]] = value
+			}
+		}
+		options = append(options, option)
+	}
+	return options, nil
+}
+
+// readOptionsJSON reads a json array of options whose name is a text or an object of texts by language
+func readOptionsJSON(r io.Reader, source string) ([]fileOption, error) {
+	items := []map[string]interface{}{}
+	if err := json.NewDecoder(r).Decode(&items); err != nil {
+		return nil, fmt.Errorf("%s: %s", source, err.Error())
+	}
+
+	options := []fileOption{}
+	for index, item := range items {
+		option := fileOption{
+			Source: fmt.Sprintf("%s[%d]", source, index),
+			Attrs:  make(map[string]string),
+			Names:  make(map[string]string),
+		}
+		for _, key := range sortedKeys(item) {
+			if !contains(optionAttributes, key) {
+				return nil, fmt.Errorf("%s: unknown key %s", option.Source, key)
+			}
+			if names, ok := item[key].(map[string]interface{}); ok && key == "name" {
+				for languageCode, text := range names {
+					value, ok := text.(string)
+					if !ok || !languagePattern.MatchString(languageCode) {
+						return nil, fmt.Errorf("%s: name must map language codes to texts", option.Source)
+					}
+					option.Names[languageCode] = value
+				}
+				continue
+			}
+			switch value := item[key].(type) {
+			case nil:
+			case string:
+				option.Attrs[key] = value
+			case bool:
+				option.Attrs[key] = strconv.FormatBool(value)
+			case float64:
+				option.Attrs[key] = strconv.FormatFloat(value, 'f', -1, 64)
+			default:
+				return nil, fmt.Errorf("%s: %s must be a text, number or boolean", option.Source, key)
+			}
+		}
+		options = append(options, option)
+	}
+	return options, nil
+}
+
+// expandOptionFiles replaces the src attribute of every options element by the options of the file,
+// so the validation checks them as if they were written in the module
+func expandOptionFiles(n *node, dir, languageCode string, violations *[]Violation) {
+	for _, child := range n.Children {
+		expandOptionFiles(child, dir, languageCode, violations)
+	}
+	src, ok := n.Attrs["src"]
+	if n.Name != "options" || !ok {
+		return
+	}
+	if len(n.Children) > 0 {
+		*violations = append(*violations, n.violation("%s: options with src can not have option elements", n.qualifiedName()))
+		return
+	}
+	options, err := loadOptionFile(filepath.Join(dir, src), languageCode)
+	if err != nil {
+		*violations = append(*violations, n.violation("%s: %s", n.qualifiedName(), err.Error()))
+		return
+	}
+	for _, option := range options {
+		n.Children = append(n.Children, &node{
+			Name:   "option",
+			Source: option.Source,
+			Attrs:  option.Attrs,
+			Line:   n.Line,
+			Column: n.Column,
+		})
+	}
+}
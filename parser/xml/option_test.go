@@ -0,0 +1,168 @@
+package xml
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeOptionFile saves an options file next to a module
+func writeOptionFile(t *testing.T, xmlFile, name, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(filepath.Join(filepath.Dir(xmlFile), name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadOptionFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		// expected has the code, name and pt-br name of every option
+		expected []string
+		err      string
+	}{
+		{
+			name:     "csv",
+			file:     "status.csv",
+			content:  "code,en-us,pt-br,order,active\nopen,Open,Aberto,1,\nclosed,Closed,Fechado,2,false\n",
+			expected: []string{"open Open Aberto", "closed Closed Fechado"},
+		},
+		{
+			name:     "csv with the name column",
+			file:     "status.csv",
+			content:  "code, name, pt-br\nopen, Open, Aberto\n",
+			expected: []string{"open Open Aberto"},
+		},
+		{
+			name:     "json",
+			file:     "status.json",
+			content:  `[{"code": "open", "name": {"en-us": "Open", "pt-br": "Aberto"}, "order": 1}, {"code": "closed", "name": "Closed", "active": false}]`,
+			expected: []string{"open Open Aberto", "closed Closed "},
+		},
+		{name: "unknown csv column", file: "status.csv", content: "code,label\nopen,Open\n", err: "status.csv: unknown column label, expected an option attribute or a language code"},
+		{name: "empty csv", file: "status.csv", content: "", err: "status.csv: missing header"},
+		{name: "names disagree", file: "status.csv", content: "code,name,en-us\nopen,Open,Opened\n", err: "status.csv:2: name Open and en-us Opened disagree"},
+		{name: "unknown json key", file: "status.json", content: `[{"code": "open", "label": "Open"}]`, err: "status.json[0]: unknown key label"},
+		{name: "invalid json name", file: "status.json", content: `[{"code": "open", "name": {"english": "Open"}}]`, err: "status.json[0]: name must map language codes to texts"},
+		{name: "invalid json value", file: "status.json", content: `[{"code": "open", "order": [1]}]`, err: "status.json[0]: order must be a text, number or boolean"},
+		{name: "malformed json", file: "status.json", content: `{"code": "open"}`, err: "status.json: json: cannot unmarshal object"},
+		{name: "unsupported file", file: "status.xml", content: "<options />", err: "must be a csv or json file"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), test.file)
+			if err := ioutil.WriteFile(fileName, []byte(test.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			options, err := loadOptionFile(fileName, "en-us")
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("expected error %s, found %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %s", err.Error())
+			}
+			found := []string{}
+			for _, option := range options {
+				found = append(found, option.Attrs["code"]+" "+option.Attrs["name"]+" "+option.Names["pt-br"])
+			}
+			if strings.Join(found, ",") != strings.Join(test.expected, ",") {
+				t.Errorf("expected options %v, found %v", test.expected, found)
+			}
+		})
+	}
+}
+
+func TestLoadMissingOptionFile(t *testing.T) {
+	if _, err := loadOptionFile(filepath.Join(t.TempDir(), "status.csv"), "en-us"); err == nil {
+		t.Error("expected an error for a missing options file")
+	}
+}
+
+func TestValidateOptionFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		options  string
+		content  string
+		expected []expectedViolation
+	}{
+		{name: "valid file", src: "status.csv", content: "code,en-us,order,parent\nopen,Open,1,\nreopened,Reopened,2,open\n"},
+		{
+			name:     "duplicate code",
+			src:      "status.csv",
+			content:  "code,en-us\nopen,Open\nopen,Opened\n",
+			expected: []expectedViolation{{6, "option (status.csv:3): duplicate option open"}},
+		},
+		{
+			name:     "dangling parent",
+			src:      "status.json",
+			content:  `[{"code": "open", "name": "Open", "parent": "draft"}]`,
+			expected: []expectedViolation{{6, "option (status.json[0]): option open: parent draft is not an option of the dataset"}},
+		},
+		{
+			name:     "missing name",
+			src:      "status.csv",
+			content:  "code,pt-br\nopen,Aberto\n",
+			expected: []expectedViolation{{6, "option (status.csv:2): missing required attribute name"}},
+		},
+		{
+			name:     "missing file",
+			src:      "missing.csv",
+			expected: []expectedViolation{{6, "options: open"}},
+		},
+		{
+			name:     "options and src",
+			src:      "status.csv",
+			options:  `<option code="open" name="Open" />`,
+			content:  "code,en-us\nclosed,Closed\n",
+			expected: []expectedViolation{{6, "options: options with src can not have option elements"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			xmlFile := writeModule(t, testModule(`<task:createDataset type="static" code="ds_tst_status" name="Status">
+        <options src="`+test.src+`">`+test.options+`</options>
+      </task:createDataset>`))
+			if test.content != "" {
+				writeOptionFile(t, xmlFile, test.src, test.content)
+			}
+			checkFileViolations(t, xmlFile, Options{}, test.expected)
+		})
+	}
+}
+
+func TestOptionFilePayload(t *testing.T) {
+	xmlFile := writeModule(t, testModule(`<task:createDataset type="static" code="ds_tst_status" name="Status">
+        <options src="status.csv" />
+      </task:createDataset>`))
+	writeOptionFile(t, xmlFile, "status.csv", "code,en-us,pt-br,order,active\nclosed,Closed,Fechado,2,false\nopen,Open,Aberto,1,\n")
+
+	x, err := parse(xmlFile, "", Options{})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	definitions := findTask(t, x, "createDataset", "ds_tst_status").ExecPayload.(datasetPayload).Definitions.(staticDatasetDefinitions)
+	if order := strings.Join(definitions.Order, ","); order != "open,closed" {
+		t.Errorf("expected the options sorted by order, found %s", order)
+	}
+	if closed := definitions.Options["closed"]; closed.Active || closed.Name["en-us"] != "Closed" {
+		t.Errorf("unexpected option closed %+v", closed)
+	}
+	translation, ok := x.Translations.Structure.CSVTranslations["/module/tasks/createContent[@code='mdl_tst']/createDataset[@code='ds_tst_status']/options/option[@code='open']name"]
+	if !ok {
+		t.Fatalf("expected a translation of option open, found %v", x.Translations.Structure.CSVTranslations)
+	}
+	texts := []string{}
+	for _, language := range translation.Languages {
+		texts = append(texts, language.Code+"="+language.Text)
+	}
+	if !contains(texts, "pt-br=Aberto") {
+		t.Errorf("expected the pt-br name of option open in the translations, found %v", texts)
+	}
+}
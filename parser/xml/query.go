@@ -0,0 +1,200 @@
+package xml
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go"
+	nodes "github.com/pganalyze/pg_query_go/nodes"
+)
+
+// queryColumns checks a dataset query is a single select calling only queryFunctions and returns its output columns,
+// star is true when the query selects * and the columns can not be known without the database
+func queryColumns(query string) ([]string, bool, error) {
+	position := 0
+	sql := paramPattern.ReplaceAllStringFunc(query, func(string) string {
+		position++
+		return "$" + strconv.Itoa(position)
+	})
+
+	tree, err := pg_query.Parse(sql)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid sql: %s", err.Error())
+	}
+	if len(tree.Statements) != 1 {
+		return nil, false, fmt.Errorf("query must be a single statement, found %d", len(tree.Statements))
+	}
+	statement := tree.Statements[0]
+	if raw, ok := statement.(nodes.RawStmt); ok {
+		statement = raw.Stmt
+	}
+	selectStmt, ok := statement.(nodes.SelectStmt)
+	if !ok {
+		return nil, false, fmt.Errorf("query must be a SELECT statement")
+	}
+	if err := readOnlySelect(selectStmt); err != nil {
+		return nil, false, err
+	}
+	if err := safeFunctions(sql); err != nil {
+		return nil, false, err
+	}
+
+	for selectStmt.Op != nodes.SETOP_NONE && selectStmt.Larg != nil {
+		selectStmt = *selectStmt.Larg
+	}
+	if len(selectStmt.TargetList.Items) == 0 {
+		return nil, true, nil
+	}
+	columns := []string{}
+	star := false
+	for _, item := range selectStmt.TargetList.Items {
+		target, ok := item.(nodes.ResTarget)
+		if !ok {
+			continue
+		}
+		if target.Name != nil {
+			columns = append(columns, *target.Name)
+			continue
+		}
+		name, isStar := expressionName(target.Val)
+		if isStar {
+			star = true
+			continue
+		}
+		columns = append(columns, name)
+	}
+	return columns, star, nil
+}
+
+// readOnlySelect rejects select statements that create tables, lock rows or modify data in a WITH clause
+func readOnlySelect(selectStmt nodes.SelectStmt) error {
+	if selectStmt.IntoClause != nil {
+		return fmt.Errorf("query must not use SELECT INTO")
+	}
+	if len(selectStmt.LockingClause.Items) > 0 {
+		return fmt.Errorf("query must not lock rows with FOR UPDATE or FOR SHARE")
+	}
+	if selectStmt.WithClause != nil {
+		for _, item := range selectStmt.WithClause.Ctes.Items {
+			cte, ok := item.(nodes.CommonTableExpr)
+			if !ok {
+				continue
+			}
+			inner, ok := cte.Ctequery.(nodes.SelectStmt)
+			if !ok {
+				return fmt.Errorf("query must not modify data in the WITH clause")
+			}
+			if err := readOnlySelect(inner); err != nil {
+				return err
+			}
+		}
+	}
+	for _, arg := range []*nodes.SelectStmt{selectStmt.Larg, selectStmt.Rarg} {
+		if arg == nil {
+			continue
+		}
+		if err := readOnlySelect(*arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryFunctions are the functions a dataset query may call, optionally qualified by pg_catalog: the functions
+// of expressionFunctions plus aggregates, window, formatting, array and json functions without side effects
+var queryFunctions = append([]string{
+	"count", "sum", "avg", "min", "max", "bool_and", "bool_or", "string_agg", "array_agg", "json_agg", "jsonb_agg",
+	"row_number", "rank", "dense_rank", "lag", "lead", "first_value", "last_value",
+	"concat_ws", "initcap", "left", "right", "lpad", "rpad", "reverse", "format", "md5", "to_char", "to_number",
+	"to_date", "to_timestamp", "mod", "power", "sqrt", "make_date", "array_to_string", "string_to_array", "unnest",
+	"json_build_object", "jsonb_build_object", "json_build_array", "jsonb_build_array", "to_json", "to_jsonb",
+	"row_to_json", "jsonb_array_elements", "jsonb_array_elements_text", "jsonb_each", "jsonb_each_text",
+	"jsonb_object_keys", "jsonb_extract_path", "jsonb_extract_path_text", "generate_series",
+}, expressionFunctions...)
+
+// safeFunctions rejects queries calling a function outside queryFunctions anywhere in the statement
+func safeFunctions(sql string) error {
+	tree, err := pg_query.ParseToJSON(sql)
+	if err != nil {
+		return fmt.Errorf("invalid sql: %s", err.Error())
+	}
+	var statements interface{}
+	if err := json.Unmarshal([]byte(tree), &statements); err != nil {
+		return err
+	}
+	return walkSQL(statements, func(nodeType string, fields map[string]interface{}) error {
+		if nodeType != "FuncCall" {
+			return nil
+		}
+		name := strings.TrimPrefix(sqlFunctionName(fields), "pg_catalog.")
+		if !contains(queryFunctions, name) {
+			return fmt.Errorf("query must not call function %s, it is not one of the read only functions accepted in a dataset", name)
+		}
+		return nil
+	})
+}
+
+// expressionName returns the column name postgres gives to an output expression without an alias
+func expressionName(expression nodes.Node) (string, bool) {
+	switch e := expression.(type) {
+	case nodes.ColumnRef:
+		if len(e.Fields.Items) == 0 {
+			break
+		}
+		switch field := e.Fields.Items[len(e.Fields.Items)-1].(type) {
+		case nodes.A_Star:
+			return "", true
+		case nodes.String:
+			return field.Str, false
+		}
+	case nodes.FuncCall:
+		if len(e.Funcname.Items) > 0 {
+			if name, ok := e.Funcname.Items[len(e.Funcname.Items)-1].(nodes.String); ok {
+				return name.Str, false
+			}
+		}
+	case nodes.TypeCast:
+		if name, isStar := expressionName(e.Arg); name != "?column?" || isStar {
+			return name, isStar
+		}
+	}
+	return "?column?", false
+}
+
+// walkSQL calls visit with the type and fields of every node of a statement parsed to json by pg_query
+func walkSQL(value interface{}, visit func(nodeType string, fields map[string]interface{}) error) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(v) {
+			if fields, ok := v[key].(map[string]interface{}); ok && key[0] >= 'A' && key[0] <= 'Z' {
+				if err := visit(key, fields); err != nil {
+					return err
+				}
+			}
+			if err := walkSQL(v[key], visit); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := walkSQL(item, visit); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sqlFunctionName returns the possibly schema qualified name of a FuncCall node
+func sqlFunctionName(fields map[string]interface{}) string {
+	names := []string{}
+	items, _ := fields["funcname"].([]interface{})
+	for _, item := range items {
+		if name, ok := item.(map[string]interface{})["String"].(map[string]interface{}); ok {
+			names = append(names, fmt.Sprint(name["str"]))
+		}
+	}
+	return strings.Join(names, ".")
+}
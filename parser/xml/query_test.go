@@ -0,0 +1,70 @@
+package xml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQueryColumns(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		columns []string
+		star    bool
+		err     string
+	}{
+		{
+			name:    "sample query",
+			query:   "select username, first_name || ' ' || last_name as full_name from core_users where active = {{param:active:boolean}}",
+			columns: []string{"username", "full_name"},
+		},
+		{
+			name:    "read only functions",
+			query:   "select lower(username) as code, count(*), pg_catalog.upper(name) from core_users where created_at < now() group by 1, 3",
+			columns: []string{"code", "count", "upper"},
+		},
+		{
+			name:    "extract and trim",
+			query:   "select extract(year from created_at) as year, trim(name) as name, u.id::text from core_users u",
+			columns: []string{"year", "name", "id"},
+		},
+		{name: "star", query: "select * from core_users", star: true},
+		{name: "union", query: "select code from core_status union select code from core_types", columns: []string{"code"}},
+		{name: "two statements", query: "select 1; select 2", err: "query must be a single statement, found 2"},
+		{name: "not a select", query: "delete from core_users", err: "query must be a SELECT statement"},
+		{name: "select into", query: "select * into backup from core_users", err: "query must not use SELECT INTO"},
+		{name: "for update", query: "select * from core_users for update", err: "query must not lock rows"},
+		{name: "modifying cte", query: "with d as (delete from core_users returning *) select * from d", err: "query must not modify data in the WITH clause"},
+		{
+			name:  "notify",
+			query: "select pg_notify('x', 'y') as username, pg_stat_reset_shared('bgwriter') as full_name",
+			err:   "query must not call function pg_notify",
+		},
+		{name: "stat reset", query: "select pg_stat_reset_shared('bgwriter') as code", err: "query must not call function pg_stat_reset_shared"},
+		{name: "terminate backend", query: "select pg_terminate_backend(pid) from pg_stat_activity", err: "must not call function pg_terminate_backend"},
+		{name: "set config", query: "select set_config('role', 'admin', false)", err: "must not call function set_config"},
+		{name: "large object", query: "select lo_import('/etc/passwd') as code", err: "must not call function lo_import"},
+		{name: "dblink", query: "select dblink_exec('host=x', 'drop table t') as code", err: "must not call function dblink_exec"},
+		{name: "nested call", query: "select code from core_status where code = lower(pg_read_file('x'))", err: "must not call function pg_read_file"},
+		{name: "subquery call", query: "select code from (select pg_sleep(10) as code) s", err: "must not call function pg_sleep"},
+		{name: "user schema", query: "select public.lower(code) from core_status", err: "must not call function public.lower"},
+		{name: "invalid sql", query: "select from where", err: "invalid sql"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			columns, star, err := queryColumns(test.query)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("expected error %s, found %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %s", err.Error())
+			}
+			if strings.Join(columns, ",") != strings.Join(test.columns, ",") || star != test.star {
+				t.Errorf("expected columns %v star %t, found %v star %t", test.columns, test.star, columns, star)
+			}
+		})
+	}
+}
@@ -0,0 +1,516 @@
+package xml
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/agile-work/srv-shared/constants"
+)
+
+// Options defines the optional checks applied to a module xml
+type Options struct {
+	// AllowlistFile lists entities that already exist on the target system
+	AllowlistFile string
+	// AllowDuplicates skips the duplicate code detection
+	AllowDuplicates bool
+	// ScaleTolerance is the accepted deviation of reciprocal scale rates, zero uses DefaultScaleTolerance
+	ScaleTolerance float64
+}
+
+// Entity kinds used by the symbol table and the allowlist file
+const (
+	entityContent = "content"
+	entitySchema  = "schema"
+	entityDataset = "dataset"
+	entityFeature = "feature"
+	entityTable   = "table"
+	entityColumn  = "column"
+	entityField   = "field"
+)
+
+type symbol struct {
+	Node    *node
+	Content *node
+}
+
+// symbolTable holds every entity defined by the module indexed by kind and code
+type symbolTable struct {
+	Entities  map[string]map[string]symbol
+	Allowlist map[string]map[string]bool
+	Options   Options
+	// Invalid holds the task elements with structure violations, their own references are not checked
+	Invalid map[*node]bool
+}
+
+func newSymbolTable() *symbolTable {
+	return &symbolTable{
+		Entities:  make(map[string]map[string]symbol),
+		Allowlist: make(map[string]map[string]bool),
+	}
+}
+
+func (s *symbolTable) add(kind, code string, sym symbol) {
+	if _, ok := s.Entities[kind]; !ok {
+		s.Entities[kind] = make(map[string]symbol)
+	}
+	if _, ok := s.Entities[kind][code]; !ok {
+		s.Entities[kind][code] = sym
+	}
+}
+
+func (s *symbolTable) lookup(kind, code string) (symbol, bool) {
+	sym, ok := s.Entities[kind][code]
+	return sym, ok
+}
+
+func (s *symbolTable) allowed(kind, code string) bool {
+	return s.Allowlist[kind][code]
+}
+
+// loadAllowlist reads a file with one "kind code" entry per line, lines starting with # are ignored
+func (s *symbolTable) loadAllowlist(allowlistFile string) error {
+	if allowlistFile == "" {
+		return nil
+	}
+	file, err := os.Open(allowlistFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Fields(line)
+		if len(parts) != 2 {
+			return fmt.Errorf("%s:%d: expected \"kind code\", found %q", allowlistFile, lineNumber, line)
+		}
+		if _, ok := s.Allowlist[parts[0]]; !ok {
+			s.Allowlist[parts[0]] = make(map[string]bool)
+		}
+		s.Allowlist[parts[0]][parts[1]] = true
+	}
+	return scanner.Err()
+}
+
+// schemaTable returns the table name the system creates for a schema of a content
+func schemaTable(content *node, code string) string {
+	if content == nil {
+		return code
+	}
+	return contentTable(content.Attrs, code)
+}
+
+// contentTable returns the table name of a schema from the system, module and prefix attributes of its content
+func contentTable(attrs map[string]string, code string) string {
+	parts := []string{}
+	if attrs["system"] == "true" {
+		parts = append(parts, "sys")
+	}
+	if attrs["module"] == "true" {
+		parts = append(parts, "mdl")
+	}
+	if prefix := attrs["prefix"]; prefix != "" {
+		parts = append(parts, prefix)
+	}
+	return strings.Join(append(parts, code), "_")
+}
+
+// buildSymbols collects the entities defined by the module
+func (s *symbolTable) buildSymbols(n, content *node) {
+	for _, child := range n.Children {
+		childContent := content
+		switch child.Name {
+		case "createContent":
+			childContent = child
+			s.add(entityContent, child.Attrs["code"], symbol{Node: child, Content: child})
+		case "createSchema":
+			s.add(entitySchema, child.Attrs["code"], symbol{Node: child, Content: content})
+			s.add(entitySchema, schemaTable(content, child.Attrs["code"]), symbol{Node: child, Content: content})
+		case "createDataset", "updateDataset":
+			s.add(entityDataset, child.Attrs["code"], symbol{Node: child, Content: content})
+		case "updateSchema":
+			s.add(entitySchema, child.Attrs["code"], symbol{Node: child, Content: content})
+		case "createFeature":
+			s.add(entityFeature, child.Attrs["moduleCode"]+"/"+child.Attrs["code"], symbol{Node: child, Content: content})
+		case "createColumn":
+			s.add(entityColumn, child.Attrs["table"]+"."+child.Attrs["code"], symbol{Node: child, Content: content})
+		}
+		s.buildSymbols(child, childContent)
+	}
+}
+
+// checkReferences reports references that do not resolve to an entity of the module or of the allowlist
+func (s *symbolTable) checkReferences(n, content, schema *node, violations *[]Violation) {
+	for _, child := range n.Children {
+		childContent := content
+		childSchema := schema
+		switch child.Name {
+		case "createContent":
+			childContent = child
+		case "createSchema", "updateSchema":
+			childSchema = child
+		case "createDataset", "updateDataset":
+			childSchema = nil
+		}
+		if s.Invalid[child] {
+			// the structure violation is reported, the nested tasks are still checked
+			s.checkReferences(child, childContent, childSchema, violations)
+			continue
+		}
+		switch child.Name {
+		case "createField", "updateField":
+			s.checkFieldReferences(child, schema, violations)
+		case "createFeature":
+			s.checkFeatureReferences(child, content, violations)
+		case "createColumn", "dropColumn":
+			s.checkTableReference(child, content, violations)
+		case "createIndex", "createConstraint":
+			s.checkTableReference(child, content, violations)
+			s.checkColumnReferences(child, child.Attrs["table"], child.Attrs["columns"], violations)
+			if child.Attrs["type"] == constraintForeignKey {
+				s.checkColumnReferences(child, child.Attrs["referencesTable"], child.Attrs["referencesColumns"], violations)
+			}
+		}
+		s.checkReferences(child, childContent, childSchema, violations)
+	}
+}
+
+func (s *symbolTable) checkFieldReferences(field, schema *node, violations *[]Violation) {
+	schemaCode := field.Attrs["schemaCode"]
+	if sym, ok := s.lookup(entitySchema, schemaCode); ok {
+		if schema != nil && sym.Node != schema {
+			*violations = append(*violations, field.violation(
+				"%s: schemaCode %s does not match the enclosing schema %s",
+				field.qualifiedName(), schemaCode, schema.Attrs["code"],
+			))
+		}
+	} else if !s.allowed(entitySchema, schemaCode) {
+		*violations = append(*violations, field.violation("%s: schema %s is not defined", field.qualifiedName(), schemaCode))
+	}
+
+	switch field.Attrs["type"] {
+	case constants.FieldNumber:
+		if scale := field.Attrs["scale"]; scale != "" {
+			s.checkDatasetReference(field, scale, constants.DatasetStatic, violations)
+			s.checkScale(field, violations)
+		}
+	case constants.FieldLookup:
+		for _, dataset := range field.Children {
+			if dataset.Name != "dataset" {
+				continue
+			}
+			expected := ""
+			if dataset.Attrs["type"] == constants.FieldLookupStatic {
+				expected = constants.DatasetStatic
+			}
+			s.checkDatasetReference(dataset, dataset.Attrs["code"], expected, violations)
+			if value, ok := field.Attrs["default"]; ok && expected == constants.DatasetStatic {
+				s.checkDefaultOption(field, dataset.Attrs["code"], value, violations)
+			}
+			if expected == "" {
+				s.checkLookupParams(dataset, violations)
+				s.checkLookupColumns(dataset, violations)
+			}
+		}
+	}
+}
+
+func (s *symbolTable) checkDatasetReference(n *node, code, expectedType string, violations *[]Violation) {
+	sym, ok := s.lookup(entityDataset, code)
+	if !ok {
+		if !s.allowed(entityDataset, code) {
+			*violations = append(*violations, n.violation("%s: dataset %s is not defined", n.qualifiedName(), code))
+		}
+		return
+	}
+	datasetType := sym.Node.Attrs["type"]
+	if expectedType != "" && datasetType != expectedType {
+		*violations = append(*violations, n.violation(
+			"%s: dataset %s is %s but a %s dataset is expected", n.qualifiedName(), code, datasetType, expectedType,
+		))
+	}
+	if expectedType == "" && datasetType == constants.DatasetStatic {
+		*violations = append(*violations, n.violation(
+			"%s: dataset %s is static but the lookup is %s", n.qualifiedName(), code, n.Attrs["type"],
+		))
+	}
+}
+
+// checkLookupParams compares the params supplied by a lookup with the params of the dataset query defined by the module
+func (s *symbolTable) checkLookupParams(dataset *node, violations *[]Violation) {
+	sym, ok := s.lookup(entityDataset, dataset.Attrs["code"])
+	if !ok {
+		return
+	}
+	query, ok := findChild(sym.Node, "query")
+	if !ok {
+		return
+	}
+	params, err := parseQueryParams(query.Text)
+	if err != nil {
+		// reported by the structure validation
+		return
+	}
+
+	supplied := make(map[string]*node)
+	if elmParams, ok := findChild(dataset, "params"); ok {
+		for _, param := range elmParams.Children {
+			supplied[param.Attrs["code"]] = param
+		}
+	}
+	declared := []string{}
+	for _, param := range params {
+		declared = append(declared, param.Code)
+		lookupParam, ok := supplied[param.Code]
+		if !ok {
+			*violations = append(*violations, dataset.violation(
+				"%s: param %s of dataset %s is not supplied", dataset.qualifiedName(), param.Code, dataset.Attrs["code"],
+			))
+			continue
+		}
+		if !compatibleValueType(param.Type, lookupParam.Attrs["valueType"]) {
+			*violations = append(*violations, lookupParam.violation(
+				"%s: param %s of dataset %s is %s but the valueType is %s",
+				lookupParam.qualifiedName(), param.Code, dataset.Attrs["code"], param.Type, lookupParam.Attrs["valueType"],
+			))
+		}
+	}
+	for _, code := range sortedKeys(supplied) {
+		if !contains(declared, code) {
+			*violations = append(*violations, supplied[code].violation(
+				"%s: param %s is not used by the query of dataset %s", supplied[code].qualifiedName(), code, dataset.Attrs["code"],
+			))
+		}
+	}
+}
+
+// checkLookupColumns reports label, value and field codes of a lookup that are not output columns of the dataset query
+func (s *symbolTable) checkLookupColumns(dataset *node, violations *[]Violation) {
+	sym, ok := s.lookup(entityDataset, dataset.Attrs["code"])
+	if !ok {
+		return
+	}
+	query, ok := findChild(sym.Node, "query")
+	if !ok {
+		return
+	}
+	columns, star, err := queryColumns(query.Text)
+	if err != nil || star {
+		// errors are reported by the structure validation and the columns of * are only known by the database
+		return
+	}
+
+	// label and value must be field codes so checking the fields covers them
+	if fields, ok := findChild(dataset, "fields"); ok {
+		for _, field := range fields.Children {
+			if !contains(columns, field.Attrs["code"]) {
+				*violations = append(*violations, field.violation(
+					"%s: field %s is not a column of the query of dataset %s", field.qualifiedName(), field.Attrs["code"], dataset.Attrs["code"],
+				))
+			}
+		}
+	}
+}
+
+// checkDefaultOption reports a lookup default that is not an option of the static dataset defined by the module
+func (s *symbolTable) checkDefaultOption(field *node, datasetCode, value string, violations *[]Violation) {
+	sym, ok := s.lookup(entityDataset, datasetCode)
+	if !ok || sym.Node.Attrs["type"] != constants.DatasetStatic {
+		return
+	}
+	codes := []string{}
+	for _, options := range sym.Node.Children {
+		if options.Name != "options" {
+			continue
+		}
+		for _, option := range options.Children {
+			codes = append(codes, option.Attrs["code"])
+		}
+	}
+	if !contains(codes, value) {
+		*violations = append(*violations, field.violation(
+			"%s: default %s is not an option of dataset %s", field.qualifiedName(), value, datasetCode,
+		))
+	}
+}
+
+func (s *symbolTable) checkFeatureReferences(feature, content *node, violations *[]Violation) {
+	moduleCode := feature.Attrs["moduleCode"]
+	if content != nil && content.Attrs["code"] == moduleCode {
+		if content.Attrs["module"] != "true" {
+			*violations = append(*violations, feature.violation(
+				"%s: content %s is not a module", feature.qualifiedName(), moduleCode,
+			))
+		}
+		return
+	}
+	if s.allowed(entityContent, moduleCode) {
+		return
+	}
+	if _, ok := s.lookup(entityContent, moduleCode); ok {
+		*violations = append(*violations, feature.violation(
+			"%s: moduleCode %s does not match the enclosing content", feature.qualifiedName(), moduleCode,
+		))
+		return
+	}
+	*violations = append(*violations, feature.violation("%s: module %s is not defined", feature.qualifiedName(), moduleCode))
+}
+
+// checkTableReference reports columns changed outside the tables of the enclosing content
+func (s *symbolTable) checkTableReference(column, content *node, violations *[]Violation) {
+	table := column.Attrs["table"]
+	if s.allowed(entityTable, table) {
+		return
+	}
+	prefix := schemaTable(content, "")
+	if content != nil && prefix == "" {
+		*violations = append(*violations, column.violation(
+			"%s: content %s has no system, module or prefix attribute to identify its tables, add table %s to the allowlist to permit it",
+			column.qualifiedName(), content.Attrs["code"], table,
+		))
+		return
+	}
+	if content == nil || !strings.HasPrefix(table, prefix) {
+		*violations = append(*violations, column.violation(
+			"%s: table %s is outside the content tables %s*, add it to the allowlist to permit it",
+			column.qualifiedName(), table, prefix,
+		))
+	}
+}
+
+// checkColumnReferences reports columns that are not created before n in the module nor allowlisted as "column table.code"
+func (s *symbolTable) checkColumnReferences(n *node, table, columns string, violations *[]Violation) {
+	for _, column := range splitColumns(columns) {
+		code := table + "." + column
+		if s.allowed(entityColumn, code) {
+			continue
+		}
+		sym, ok := s.lookup(entityColumn, code)
+		if !ok {
+			*violations = append(*violations, n.violation("%s: column %s is not defined", n.qualifiedName(), code))
+			continue
+		}
+		if sym.Node.Line > n.Line || (sym.Node.Line == n.Line && sym.Node.Column > n.Column) {
+			*violations = append(*violations, n.violation(
+				"%s: column %s is created later at %d:%d", n.qualifiedName(), code, sym.Node.Line, sym.Node.Column,
+			))
+		}
+	}
+}
+
+// fieldSchema returns the table name of the schema referenced by a field so fields using the schema code or its table are grouped together
+func (s *symbolTable) fieldSchema(schemaCode string) string {
+	if sym, ok := s.lookup(entitySchema, schemaCode); ok {
+		return schemaTable(sym.Content, sym.Node.Attrs["code"])
+	}
+	return schemaCode
+}
+
+// checkFormulas reports formula expressions that do not parse, reference fields missing from their schema or depend on themselves
+func (s *symbolTable) checkFormulas(root *node, violations *[]Violation) {
+	fields := make(map[string]map[string]*node)
+	formulas := []*node{}
+	var walk func(n *node)
+	walk = func(n *node) {
+		for _, child := range n.Children {
+			if child.Name == "createField" {
+				schema := s.fieldSchema(child.Attrs["schemaCode"])
+				if _, ok := fields[schema]; !ok {
+					fields[schema] = make(map[string]*node)
+				}
+				fields[schema][child.Attrs["code"]] = child
+				if child.Attrs["type"] == fieldFormula && !s.Invalid[child] {
+					formulas = append(formulas, child)
+				}
+			}
+			walk(child)
+		}
+	}
+	walk(root)
+
+	dependencies := make(map[*node][]*node)
+	for _, formula := range formulas {
+		expression := ""
+		for _, child := range formula.Children {
+			if child.Name == "expression" {
+				expression = child.Text
+			}
+		}
+		codes, err := parseFormula(strings.TrimSpace(expression))
+		if err != nil {
+			*violations = append(*violations, formula.violation("%s: invalid expression: %s", formula.qualifiedName(), err.Error()))
+			continue
+		}
+		schemaCode := formula.Attrs["schemaCode"]
+		for _, code := range codes {
+			field, ok := fields[s.fieldSchema(schemaCode)][code]
+			if ok {
+				dependencies[formula] = append(dependencies[formula], field)
+			} else if !s.allowed(entityField, schemaCode+"."+code) {
+				*violations = append(*violations, formula.violation(
+					"%s: field %s is not defined in schema %s", formula.qualifiedName(), code, schemaCode,
+				))
+			}
+		}
+	}
+
+	// a depth first search reports each cycle once, at the formula that closes it
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[*node]int)
+	var visit func(field *node, stack []*node)
+	visit = func(field *node, stack []*node) {
+		state[field] = visiting
+		stack = append(stack, field)
+		for _, dependency := range dependencies[field] {
+			switch state[dependency] {
+			case visiting:
+				cycle := []string{}
+				for i := len(stack) - 1; i >= 0; i-- {
+					cycle = append([]string{stack[i].Attrs["code"]}, cycle...)
+					if stack[i] == dependency {
+						break
+					}
+				}
+				*violations = append(*violations, field.violation(
+					"%s: formula cycle %s -> %s", field.qualifiedName(), strings.Join(cycle, " -> "), dependency.Attrs["code"],
+				))
+			case 0:
+				visit(dependency, stack)
+			}
+		}
+		state[field] = visited
+	}
+	for _, formula := range formulas {
+		if state[formula] == 0 {
+			visit(formula, nil)
+		}
+	}
+}
+
+// resolveReferences runs the reference resolution pass over the module skipping the references of invalid task elements,
+// entities are collected from the whole module so references to an invalid element are not reported twice
+func resolveReferences(root *node, invalid map[*node]bool, options Options) ([]Violation, error) {
+	symbols := newSymbolTable()
+	symbols.Options = options
+	symbols.Invalid = invalid
+	if err := symbols.loadAllowlist(options.AllowlistFile); err != nil {
+		return nil, err
+	}
+	symbols.buildSymbols(root, nil)
+
+	violations := []Violation{}
+	symbols.checkReferences(root, nil, nil, &violations)
+	symbols.checkFormulas(root, &violations)
+	return violations, nil
+}
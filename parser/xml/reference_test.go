@@ -0,0 +1,233 @@
+package xml
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateReferences(t *testing.T) {
+	tests := []struct {
+		name     string
+		tasks    string
+		expected []expectedViolation
+	}{
+		{
+			name: "undefined schema",
+			tasks: `<task:createSchema code="tasks" name="Tasks">
+        <task:createField schemaCode="sys_mdl_tst_other" type="text" code="title" name="Title" />
+      </task:createSchema>`,
+			expected: []expectedViolation{{6, "task:createField: schema sys_mdl_tst_other is not defined"}},
+		},
+		{
+			name: "field in another schema",
+			tasks: `<task:createSchema code="tasks" name="Tasks" />
+      <task:createSchema code="baselines" name="Baselines">
+        <task:createField schemaCode="sys_mdl_tst_tasks" type="text" code="title" name="Title" />
+      </task:createSchema>`,
+			expected: []expectedViolation{{7, "schemaCode sys_mdl_tst_tasks does not match the enclosing schema baselines"}},
+		},
+		{
+			name: "undefined lookup dataset",
+			tasks: `<task:createSchema code="tasks" name="Tasks">
+        <task:createField schemaCode="sys_mdl_tst_tasks" type="lookup" code="status" name="Status">
+          <dataset code="ds_tst_status" type="static" />
+        </task:createField>
+      </task:createSchema>`,
+			expected: []expectedViolation{{7, "dataset: dataset ds_tst_status is not defined"}},
+		},
+		{
+			name: "static lookup of a dynamic dataset",
+			tasks: `<task:createDataset type="dynamic" code="ds_tst_status" name="Status">
+        <query>select code, name from core_status</query>
+      </task:createDataset>
+      <task:createSchema code="tasks" name="Tasks">
+        <task:createField schemaCode="sys_mdl_tst_tasks" type="lookup" code="status" name="Status">
+          <dataset code="ds_tst_status" type="static" />
+        </task:createField>
+      </task:createSchema>`,
+			expected: []expectedViolation{{10, "dataset ds_tst_status is dynamic but a static dataset is expected"}},
+		},
+		{
+			name: "dynamic lookup of a static dataset",
+			tasks: `<task:createDataset type="static" code="ds_tst_status" name="Status">
+        <options>
+          <option code="open" name="Open" />
+        </options>
+      </task:createDataset>
+      <task:createSchema code="tasks" name="Tasks">
+        <task:createField schemaCode="sys_mdl_tst_tasks" type="lookup" code="status" name="Status">
+          <dataset code="ds_tst_status" type="dynamic" label="code" value="code">
+            <fields>
+              <field code="code" />
+            </fields>
+          </dataset>
+        </task:createField>
+      </task:createSchema>`,
+			expected: []expectedViolation{{12, "dataset ds_tst_status is static but the lookup is dynamic"}},
+		},
+		{
+			name: "undefined scale dataset",
+			tasks: `<task:createSchema code="tasks" name="Tasks">
+        <task:createField schemaCode="sys_mdl_tst_tasks" type="number" code="effort" name="Effort" scale="ds_tst_scale" />
+      </task:createSchema>`,
+			expected: []expectedViolation{{6, "task:createField: dataset ds_tst_scale is not defined"}},
+		},
+		{
+			name: "undefined feature module",
+			tasks: `<task:createFeature moduleCode="mdl_other" code="board" name="Board">
+        <permission code="view" name="View" />
+      </task:createFeature>`,
+			expected: []expectedViolation{{5, "task:createFeature: module mdl_other is not defined"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkViolations(t, testModule(test.tasks), Options{}, test.expected)
+		})
+	}
+}
+
+func TestValidateFeatureContent(t *testing.T) {
+	module := `<horizon:module version="1.0">
+  <definition languageCode="en-us" contentPackage="mdl_tst" />
+  <tasks>
+    <task:createContent code="cnt_tst" name="Test" prefix="tst">
+      <task:createFeature moduleCode="cnt_tst" code="board" name="Board" />
+    </task:createContent>
+    <task:createContent code="mdl_tst" name="Test" prefix="tst" module="true">
+      <task:createFeature moduleCode="cnt_tst" code="list" name="List" />
+    </task:createContent>
+  </tasks>
+</horizon:module>`
+	checkViolations(t, module, Options{}, []expectedViolation{
+		{5, "task:createFeature: content cnt_tst is not a module"},
+		{8, "task:createFeature: moduleCode cnt_tst does not match the enclosing content"},
+	})
+}
+
+func TestValidateAllowlist(t *testing.T) {
+	module := testModule(`<task:createSchema code="tasks" name="Tasks">
+        <task:createField schemaCode="sys_mdl_tst_tasks" type="number" code="effort" name="Effort" scale="ds_core_scale" />
+        <task:createField schemaCode="sys_mdl_tst_tasks" type="lookup" code="owner" name="Owner">
+          <dataset code="ds_core_users" type="static" />
+        </task:createField>
+      </task:createSchema>
+      <task:createFeature moduleCode="mdl_core" code="board" name="Board" />`)
+
+	tests := []struct {
+		name      string
+		allowlist string
+		expected  []expectedViolation
+	}{
+		{
+			name: "entities missing from the allowlist",
+			expected: []expectedViolation{
+				{6, "dataset ds_core_scale is not defined"},
+				{8, "dataset ds_core_users is not defined"},
+				{11, "module mdl_core is not defined"},
+			},
+		},
+		{
+			name:      "allowlisted entities",
+			allowlist: "# existing entities\n\ndataset ds_core_scale\ndataset ds_core_users\ncontent mdl_core\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := Options{}
+			if test.allowlist != "" {
+				options.AllowlistFile = filepath.Join(t.TempDir(), "module.allowlist")
+				if err := ioutil.WriteFile(options.AllowlistFile, []byte(test.allowlist), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			checkViolations(t, module, options, test.expected)
+		})
+	}
+}
+
+func TestValidateInvalidAllowlist(t *testing.T) {
+	tests := []struct {
+		allowlist string
+		err       string
+	}{
+		{"dataset\n", `module.allowlist:1: expected "kind code", found "dataset"`},
+		{"# comment\ndataset ds_a ds_b\n", `module.allowlist:2: expected "kind code", found "dataset ds_a ds_b"`},
+	}
+	for _, test := range tests {
+		allowlistFile := filepath.Join(t.TempDir(), "module.allowlist")
+		if err := ioutil.WriteFile(allowlistFile, []byte(test.allowlist), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := Validate(writeModule(t, testModule("")), Options{AllowlistFile: allowlistFile})
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("expected error %s, found %v", test.err, err)
+		}
+	}
+}
+
+func TestValidateTableReference(t *testing.T) {
+	content := func(attrs, tasks string) string {
+		return `<horizon:module version="1.0">
+  <definition languageCode="en-us" contentPackage="mdl_tst" />
+  <tasks>
+    <task:createContent code="cnt_tst" name="Test"` + attrs + `>
+` + tasks + `
+    </task:createContent>
+  </tasks>
+</horizon:module>`
+	}
+	tests := []struct {
+		name      string
+		module    string
+		allowlist string
+		expected  []expectedViolation
+	}{
+		{
+			name:   "table of the content",
+			module: testModule(`<task:createColumn table="sys_mdl_tst_tasks" type="text" code="notes" />`),
+		},
+		{
+			name:     "table outside the content",
+			module:   testModule(`<task:createColumn table="core_users" type="text" code="notes" />`),
+			expected: []expectedViolation{{5, "task:createColumn: table core_users is outside the content tables sys_mdl_tst_*"}},
+		},
+		{
+			name:     "content without prefix",
+			module:   content("", `<task:createColumn table="cnt_tst_tasks" type="text" code="notes" />`),
+			expected: []expectedViolation{{5, "task:createColumn: content cnt_tst has no system, module or prefix attribute to identify its tables"}},
+		},
+		{
+			name: "index of a content without prefix",
+			module: content("", `<task:createColumn table="tasks" type="text" code="notes" />
+<task:createIndex table="tasks" code="notes_idx" columns="notes" />`),
+			expected: []expectedViolation{
+				{5, "content cnt_tst has no system, module or prefix attribute"},
+				{6, "content cnt_tst has no system, module or prefix attribute"},
+			},
+		},
+		{
+			name:      "allowlisted table of a content without prefix",
+			module:    content("", `<task:createColumn table="core_users" type="text" code="notes" />`),
+			allowlist: "table core_users\n",
+		},
+		{
+			name:   "content with a prefix only",
+			module: content(` prefix="tst"`, `<task:createColumn table="tst_tasks" type="text" code="notes" />`),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := Options{}
+			if test.allowlist != "" {
+				options.AllowlistFile = filepath.Join(t.TempDir(), "module.allowlist")
+				if err := ioutil.WriteFile(options.AllowlistFile, []byte(test.allowlist), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			checkViolations(t, test.module, options, test.expected)
+		})
+	}
+}
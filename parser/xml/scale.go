@@ -0,0 +1,129 @@
+package xml
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// DefaultScaleTolerance is the accepted deviation from 1 of the product of a rate and its reciprocal
+const DefaultScaleTolerance = 0.01
+
+// scaleRate is a conversion rate read from the scale matrix of a number field
+type scaleRate struct {
+	Node  *node
+	Value float64
+}
+
+// checkScale reports incomplete matrices, invalid or inconsistent rates and units that are not options of the scale dataset
+func (s *symbolTable) checkScale(field *node, violations *[]Violation) {
+	rule := moduleRules[field.Name]
+	units := []string{}
+	rates := make(map[string]map[string]scaleRate)
+	for _, unit := range field.Children {
+		if contains(rule.Children, unit.Name) || contains(taskElements, unit.Name) {
+			continue
+		}
+		units = append(units, unit.Name)
+		rates[unit.Name] = make(map[string]scaleRate)
+		for _, target := range unit.Children {
+			value, err := strconv.ParseFloat(target.Attrs["value"], 64)
+			if err != nil {
+				// reported by the structure validation
+				continue
+			}
+			if value <= 0 {
+				*violations = append(*violations, target.violation("%s: rate from %s to %s must be positive, found %s", target.qualifiedName(), unit.Name, target.Name, target.Attrs["value"]))
+				continue
+			}
+			rates[unit.Name][target.Name] = scaleRate{Node: target, Value: value}
+		}
+	}
+
+	for _, unit := range field.Children {
+		from, ok := rates[unit.Name]
+		if !ok {
+			continue
+		}
+		for _, target := range unit.Children {
+			if target.Name == unit.Name {
+				*violations = append(*violations, target.violation("%s: unit %s can not have a rate to itself", target.qualifiedName(), unit.Name))
+			} else if _, ok := rates[target.Name]; !ok {
+				*violations = append(*violations, target.violation("%s: unit %s is not defined in the scale", target.qualifiedName(), target.Name))
+			}
+		}
+		for _, to := range units {
+			if to == unit.Name {
+				continue
+			}
+			rate, ok := from[to]
+			if !ok {
+				if _, present := findChild(unit, to); !present {
+					*violations = append(*violations, unit.violation("%s: missing rate from %s to %s", unit.qualifiedName(), unit.Name, to))
+				}
+				continue
+			}
+			reciprocal, ok := rates[to][unit.Name]
+			if !ok || unit.Name > to {
+				continue
+			}
+			if math.Abs(rate.Value*reciprocal.Value-1) > s.Options.scaleTolerance()+1e-9 {
+				*violations = append(*violations, rate.Node.violation(
+					"%s: rate from %s to %s is %s but the rate from %s to %s is %s, expected %s",
+					rate.Node.qualifiedName(), unit.Name, to, rate.Node.Attrs["value"], to, unit.Name, reciprocal.Node.Attrs["value"],
+					strconv.FormatFloat(1/reciprocal.Value, 'f', -1, 64),
+				))
+			}
+		}
+	}
+
+	s.checkScaleUnits(field, units, violations)
+}
+
+// checkScaleUnits compares the units of the matrix with the options of the scale dataset when the module defines it
+func (s *symbolTable) checkScaleUnits(field *node, units []string, violations *[]Violation) {
+	sym, ok := s.lookup(entityDataset, field.Attrs["scale"])
+	if !ok || len(units) == 0 {
+		return
+	}
+	options := []string{}
+	for _, elmOptions := range sym.Node.Children {
+		if elmOptions.Name != "options" {
+			continue
+		}
+		for _, option := range elmOptions.Children {
+			options = append(options, option.Attrs["code"])
+		}
+	}
+	for _, unit := range field.Children {
+		if contains(units, unit.Name) && !contains(options, unit.Name) {
+			*violations = append(*violations, unit.violation("%s: unit %s is not an option of dataset %s", unit.qualifiedName(), unit.Name, field.Attrs["scale"]))
+		}
+	}
+	missing := []string{}
+	for _, option := range options {
+		if !contains(units, option) {
+			missing = append(missing, option)
+		}
+	}
+	sort.Strings(missing)
+	for _, option := range missing {
+		*violations = append(*violations, field.violation("%s: option %s of dataset %s has no unit in the scale", field.qualifiedName(), option, field.Attrs["scale"]))
+	}
+}
+
+func findChild(n *node, name string) (*node, bool) {
+	for _, child := range n.Children {
+		if child.Name == name {
+			return child, true
+		}
+	}
+	return nil, false
+}
+
+func (o Options) scaleTolerance() float64 {
+	if o.ScaleTolerance <= 0 {
+		return DefaultScaleTolerance
+	}
+	return o.ScaleTolerance
+}
@@ -1,36 +1,77 @@
 package xml
 
 import (
-	"encoding/json"
 	"fmt"
 
+	"github.com/agile-work/cli/action"
 	"github.com/agile-work/srv-shared/constants"
 	"github.com/beevik/etree"
 )
 
+type schemaPayload struct {
+	Code        string            `json:"code"`
+	ContentCode string            `json:"content_code"`
+	Name        map[string]string `json:"name"`
+	Description map[string]string `json:"description"`
+}
+
+type schemaUpdatePayload struct {
+	Name        map[string]string `json:"name,omitempty"`
+	Description map[string]string `json:"description,omitempty"`
+}
+
 func createSchema(x *xml, element *etree.Element, taskSequence int, path string) error {
 	elmCode := element.SelectAttrValue("code", "")
 	elmName := element.SelectAttrValue("name", "")
 	elmDescription := element.SelectAttrValue("desc", "")
 
 	path = fmt.Sprintf("%s/createSchema[@code='%s']", path, elmCode)
-	if err := x.processTranslation(path, "name", &elmName); err != nil {
-		return err
+
+	task := task{
+		Type:        "createSchema",
+		Code:        elmCode,
+		Path:        path,
+		Element:     element,
+		Sequence:    taskSequence,
+		ExecAction:  constants.ExecuteAPIPost,
+		ExecAddress: "{system.api_host}/api/v1/core/admin/schemas",
+		ExecPayload: schemaPayload{
+			Code:        elmCode,
+			ContentCode: x.ContentCode,
+			Name:        x.processTranslation(path, "name", elmName),
+			Description: x.processTranslation(path, "description", elmDescription),
+		},
 	}
-	if err := x.processTranslation(path, "description", &elmDescription); err != nil {
+
+	x.Tasks = append(x.Tasks, task)
+
+	if err := x.processTask(element.ChildElements(), taskSequence, path); err != nil {
 		return err
 	}
+	return nil
+}
+
+func updateSchema(x *xml, element *etree.Element, taskSequence int, path string) error {
+	elmCode := element.SelectAttrValue("code", "")
+
+	path = fmt.Sprintf("%s/updateSchema[@code='%s']", path, elmCode)
+	payload := schemaUpdatePayload{}
+	if elmName := element.SelectAttr("name"); elmName != nil {
+		payload.Name = x.processTranslation(path, "name", elmName.Value)
+	}
+	if elmDescription := element.SelectAttr("desc"); elmDescription != nil {
+		payload.Description = x.processTranslation(path, "description", elmDescription.Value)
+	}
 
 	task := task{
+		Type:        "updateSchema",
+		Code:        elmCode,
+		Path:        path,
+		Element:     element,
 		Sequence:    taskSequence,
-		ExecAction:  constants.ExecuteAPIPost,
-		ExecAddress: "{system.api_host}/api/v1/core/admin/schemas",
-		ExecPayload: (json.RawMessage)([]byte(fmt.Sprintf(`{
-			"code": "%s",
-			"content_code": "%s",
-			"name": %s,
-			"description": %s
-		}`, elmCode, x.ContentCode, elmName, elmDescription))),
+		ExecAction:  action.ExecuteAPIPatch,
+		ExecAddress: fmt.Sprintf("{system.api_host}/api/v1/core/admin/schemas/%s", elmCode),
+		ExecPayload: payload,
 	}
 
 	x.Tasks = append(x.Tasks, task)
@@ -40,3 +81,42 @@ func createSchema(x *xml, element *etree.Element, taskSequence int, path string)
 	}
 	return nil
 }
+
+func deleteSchema(x *xml, element *etree.Element, taskSequence int) error {
+	elmCode := element.SelectAttrValue("code", "")
+
+	task, err := deleteTask(element, taskSequence, elmCode, fmt.Sprintf("{system.api_host}/api/v1/core/admin/schemas/%s", elmCode))
+	if err != nil {
+		return err
+	}
+	x.Tasks = append(x.Tasks, task)
+	segments := []string{
+		fmt.Sprintf("createSchema[@code='%s']", elmCode),
+		fmt.Sprintf("updateSchema[@code='%s']", elmCode),
+	}
+	segments = append(segments, schemaFieldSegments(element, "createField")...)
+	segments = append(segments, schemaFieldSegments(element, "updateField")...)
+	x.removeTranslations(segments...)
+	return nil
+}
+
+// schemaFieldSegments returns the path segments of the field elements of a schema,
+// fields name their schema by code or by the table of the enclosing content
+func schemaFieldSegments(element *etree.Element, tag string) []string {
+	code := element.SelectAttrValue("code", "")
+	segments := []string{fmt.Sprintf("%s[@schemaCode='%s']", tag, code)}
+	for parent := element.Parent(); parent != nil; parent = parent.Parent() {
+		if parent.Tag != "createContent" {
+			continue
+		}
+		attrs := make(map[string]string)
+		for _, attr := range parent.Attr {
+			attrs[attr.Key] = attr.Value
+		}
+		if table := contentTable(attrs, code); table != code {
+			segments = append(segments, fmt.Sprintf("%s[@schemaCode='%s']", tag, table))
+		}
+		break
+	}
+	return segments
+}
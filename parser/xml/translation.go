@@ -3,11 +3,10 @@ package xml
 import (
 	"bufio"
 	"encoding/csv"
-	"encoding/json"
-	"fmt"
 	"io"
 	"os"
 	"strconv"
+	"strings"
 )
 
 type translation struct {
@@ -83,12 +82,34 @@ func (t *translation) loadCSV(csvPath string) error {
 	return nil
 }
 
-func (x *xml) processTranslation(path, code string, text *string) error {
-	x.addTranslation(path, code, *text)
-	if err := x.loadTranslation(path, code, text); err != nil {
-		return err
+func (x *xml) processTranslation(path, code, text string) map[string]string {
+	x.addTranslation(path, code, text)
+	return x.loadTranslation(path, code, text)
+}
+
+// processTranslations registers a text known in several languages, the translation csv keeps precedence over the given texts
+func (x *xml) processTranslations(path, code string, texts map[string]string) map[string]string {
+	x.addTranslation(path, code, texts[x.LanguageCode])
+	for _, languageCode := range sortedKeys(texts) {
+		if languageCode == x.LanguageCode {
+			continue
+		}
+		if !contains(x.Translations.Structure.CSVHeader[3:], languageCode) {
+			x.Translations.Structure.CSVHeader = append(x.Translations.Structure.CSVHeader, languageCode)
+			for key, csvTranslation := range x.Translations.Structure.CSVTranslations {
+				csvTranslation.Languages = append(csvTranslation.Languages, language{Code: languageCode})
+				x.Translations.Structure.CSVTranslations[key] = csvTranslation
+			}
+		}
+		csvTranslation := x.Translations.Structure.CSVTranslations[path+code]
+		for i := range csvTranslation.Languages {
+			if csvTranslation.Languages[i].Code == languageCode && csvTranslation.Languages[i].Text == "" {
+				csvTranslation.Languages[i].Text = texts[languageCode]
+			}
+		}
+		x.Translations.Structure.CSVTranslations[path+code] = csvTranslation
 	}
-	return nil
+	return x.loadTranslation(path, code, texts[x.LanguageCode])
 }
 
 func (x *xml) addTranslation(path, code, text string) {
@@ -117,27 +138,39 @@ func (x *xml) addTranslation(path, code, text string) {
 	}
 }
 
-func (x *xml) loadTranslation(path, code string, text *string) error {
+func (x *xml) loadTranslation(path, code, text string) map[string]string {
+	languages := make(map[string]string)
 	if csvTranslation, ok := x.Translations.Structure.CSVTranslations[path+code]; ok {
-		languages := make(map[string]string)
 		for _, language := range csvTranslation.Languages {
 			if language.Text != "" {
 				languages[language.Code] = language.Text
 			}
 		}
-		languagesByte, err := json.MarshalIndent(languages, "", "  ")
-		if err != nil {
-			return err
-		}
-		*text = string(languagesByte)
 	} else {
-		*text = fmt.Sprintf(`{ "%s": "%s" }`, x.LanguageCode, *text)
+		languages[x.LanguageCode] = text
+	}
+	return languages
+}
+
+// removeTranslations registers path segments of deleted entities whose translations are no longer valid
+func (x *xml) removeTranslations(segments ...string) {
+	x.Removed = append(x.Removed, segments...)
+}
+
+func (x *xml) invalidateTranslations() {
+	for key, csvTranslation := range x.Translations.Structure.CSVTranslations {
+		for _, segment := range x.Removed {
+			if strings.Contains(csvTranslation.Path+"/", "/"+segment+"/") || strings.Contains(csvTranslation.Path, "/"+segment+"[") {
+				csvTranslation.Valid = false
+				x.Translations.Structure.CSVTranslations[key] = csvTranslation
+				break
+			}
+		}
 	}
-	return nil
 }
 
 func (x *xml) createTranslation(fileName string) error {
-	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE, 0644)
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,793 @@
+package xml
+
+import (
+	"bytes"
+	encodingXML "encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/agile-work/srv-shared/constants"
+)
+
+// Violation defines a structural error found in the module xml
+type Violation struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%d:%d: %s", v.Line, v.Column, v.Message)
+}
+
+// node is a position aware representation of a xml element used by the validation
+type node struct {
+	Name     string
+	Prefix   string
+	Attrs    map[string]string
+	Children []*node
+	Text     string
+	Line     int
+	Column   int
+	// Source is the file and position of an option loaded from a options file
+	Source string
+}
+
+func (n *node) qualifiedName() string {
+	if n.Source != "" {
+		return fmt.Sprintf("%s (%s)", n.Name, n.Source)
+	}
+	if n.Prefix != "" {
+		return n.Prefix + ":" + n.Name
+	}
+	return n.Name
+}
+
+// elementRule defines what an element of the module xml may contain
+type elementRule struct {
+	Required []string
+	Optional []string
+	// Values restrict an attribute to a list of accepted values
+	Values map[string][]string
+	// Kinds restrict an attribute to a value type (boolean or integer)
+	Kinds map[string]string
+	// Single are child elements that must appear exactly once
+	Single []string
+	// Children are child elements that may appear any number of times
+	Children []string
+	// Tasks allows nested task elements
+	Tasks bool
+}
+
+var taskElements = []string{
+	"createContent",
+	"createSchema",
+	"createField",
+	"createColumn",
+	"createIndex",
+	"createConstraint",
+	"createDataset",
+	"createFeature",
+	"updateSchema",
+	"updateField",
+	"updateDataset",
+	"deleteContent",
+	"deleteSchema",
+	"deleteField",
+	"deleteDataset",
+	"deleteFeature",
+	"dropColumn",
+}
+
+var moduleRules = map[string]elementRule{
+	"module": {
+		Optional: []string{"version"},
+		Single:   []string{"definition", "tasks"},
+	},
+	"definition": {
+		Required: []string{"contentPackage"},
+		Optional: []string{"languageCode"},
+	},
+	"tasks": {
+		Tasks: true,
+	},
+	"createContent": {
+		Required: []string{"code", "name"},
+		Optional: []string{"desc", "prefix", "module", "system"},
+		Kinds:    map[string]string{"module": "boolean", "system": "boolean"},
+		Tasks:    true,
+	},
+	"createSchema": {
+		Required: []string{"code", "name"},
+		Optional: []string{"desc"},
+		Tasks:    true,
+	},
+	"createField": {
+		Required: []string{"schemaCode", "type", "code", "name"},
+		Optional: []string{"desc", "display", "decimals", "scale", "format", "maxLength", "currency", "maxSize", "maxFiles", "thumbnail", "resultType", "default", "timezone"},
+		Values: map[string][]string{
+			"type":       fieldTypes,
+			"resultType": formulaResultTypes,
+		},
+		Kinds:    map[string]string{"decimals": "integer", "maxLength": "integer", "maxFiles": "integer", "thumbnail": "boolean"},
+		Children: []string{"dataset", "accept", "expression", "validation", "default"},
+		Tasks:    true,
+	},
+	"createColumn": {
+		Required: []string{"table", "type", "code"},
+		Optional: []string{"nullable", "default", "ifNotExists"},
+		Kinds:    map[string]string{"nullable": "boolean", "ifNotExists": "boolean"},
+	},
+	"createIndex": {
+		Required: []string{"table", "code", "columns"},
+		Optional: []string{"method", "unique", "where", "concurrently", "ifNotExists"},
+		Values:   map[string][]string{"method": indexMethods},
+		Kinds:    map[string]string{"unique": "boolean", "concurrently": "boolean", "ifNotExists": "boolean"},
+	},
+	"createConstraint": {
+		Required: []string{"table", "code", "type"},
+		Optional: []string{"columns", "expression", "referencesTable", "referencesColumns", "onDelete"},
+		Values: map[string][]string{
+			"type":     {constraintUnique, constraintCheck, constraintForeignKey},
+			"onDelete": {"noAction", "restrict", "cascade", "setNull", "setDefault"},
+		},
+	},
+	"createDataset": {
+		Required: []string{"code", "name", "type"},
+		Optional: []string{"desc"},
+		Values: map[string][]string{
+			"type": {constants.DatasetStatic, "dynamic"},
+		},
+		Children: []string{"options", "query"},
+		Tasks:    true,
+	},
+	"createFeature": {
+		Required: []string{"moduleCode", "code", "name"},
+		Optional: []string{"desc"},
+		Children: []string{"permission"},
+		Tasks:    true,
+	},
+	"updateSchema": {
+		Required: []string{"code"},
+		Optional: []string{"name", "desc"},
+		Tasks:    true,
+	},
+	"updateField": {
+		Required: []string{"schemaCode", "type", "code"},
+		Optional: []string{"name", "desc", "display", "decimals", "scale", "format", "maxLength", "currency", "maxSize", "maxFiles", "thumbnail", "resultType", "default", "timezone"},
+		Values: map[string][]string{
+			"type":       fieldTypes,
+			"resultType": formulaResultTypes,
+		},
+		Kinds:    map[string]string{"decimals": "integer", "maxLength": "integer", "maxFiles": "integer", "thumbnail": "boolean"},
+		Children: []string{"dataset", "accept", "expression", "validation", "default"},
+		Tasks:    true,
+	},
+	"updateDataset": {
+		Required: []string{"code", "type"},
+		Optional: []string{"name", "desc"},
+		Values: map[string][]string{
+			"type": {constants.DatasetStatic, "dynamic"},
+		},
+		Children: []string{"options", "query"},
+		Tasks:    true,
+	},
+	"deleteContent": {
+		Required: []string{"code"},
+		Optional: []string{"ifExists"},
+		Kinds:    map[string]string{"ifExists": "boolean"},
+	},
+	"deleteSchema": {
+		Required: []string{"code"},
+		Optional: []string{"ifExists"},
+		Kinds:    map[string]string{"ifExists": "boolean"},
+	},
+	"deleteField": {
+		Required: []string{"schemaCode", "code"},
+		Optional: []string{"ifExists"},
+		Kinds:    map[string]string{"ifExists": "boolean"},
+	},
+	"deleteDataset": {
+		Required: []string{"code"},
+		Optional: []string{"ifExists"},
+		Kinds:    map[string]string{"ifExists": "boolean"},
+	},
+	"deleteFeature": {
+		Required: []string{"moduleCode", "code"},
+		Optional: []string{"ifExists"},
+		Kinds:    map[string]string{"ifExists": "boolean"},
+	},
+	"dropColumn": {
+		Required: []string{"table", "code"},
+		Optional: []string{"ifExists"},
+		Kinds:    map[string]string{"ifExists": "boolean"},
+	},
+	"permission": {
+		Required: []string{"code", "name"},
+	},
+	"options": {
+		Optional: []string{"src"},
+		Children: []string{"option"},
+	},
+	"option": {
+		Required: []string{"code", "name"},
+		Optional: []string{"active", "color", "icon", "order", "parent"},
+	},
+	"query": {},
+	"accept": {
+		Children: []string{"mime"},
+	},
+	"expression": {},
+	"default":    {},
+	"validation": {
+		Optional: []string{"required", "unique", "min", "max", "minLength", "maxLength", "pattern"},
+		Kinds:    map[string]string{"required": "boolean", "unique": "boolean", "minLength": "integer", "maxLength": "integer"},
+	},
+	"mime": {
+		Required: []string{"type"},
+	},
+	"dataset": {
+		Required: []string{"code", "type"},
+		Optional: []string{"label", "value", "lookup_label", "lookup_value"},
+		Values: map[string][]string{
+			"type": {constants.FieldLookupStatic, "dynamic", "security"},
+		},
+		Children: []string{"fields", "groups", "params"},
+	},
+	"fields": {
+		Children: []string{"field"},
+	},
+	"field": {
+		Required: []string{"code"},
+		Optional: []string{"name"},
+		Children: []string{"filter"},
+	},
+	"filter": {
+		Optional: []string{"type", "value", "valueType", "itemType", "operator", "readonly"},
+		Values:   map[string][]string{"valueType": valueTypes, "itemType": valueTypes},
+		Kinds:    map[string]string{"readonly": "boolean"},
+	},
+	"groups": {},
+	"params": {
+		Children: []string{"param"},
+	},
+	"param": {
+		Required: []string{"code"},
+		Optional: []string{"type", "value", "valueType", "itemType"},
+		Values:   map[string][]string{"valueType": valueTypes, "itemType": valueTypes},
+	},
+}
+
+// Validate checks the module xml structure and references and returns every violation found
+func Validate(xmlFile string, options Options) ([]Violation, error) {
+	data, err := ioutil.ReadFile(xmlFile)
+	if err != nil {
+		return nil, err
+	}
+	root, err := readNodes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	violations := []Violation{}
+	languageCode := "en-us"
+	if definition, ok := findChild(root, "definition"); ok && definition.Attrs["languageCode"] != "" {
+		languageCode = definition.Attrs["languageCode"]
+	}
+	expandOptionFiles(root, filepath.Dir(xmlFile), languageCode, &violations)
+	if root.Name != "module" {
+		violations = append(violations, root.violation("root element must be horizon:module, found %s", root.qualifiedName()))
+	} else {
+		validateNode(root, moduleRules["module"], &violations)
+	}
+	if root.Name == "module" {
+		// tasks with structure violations are not checked themselves, their nested tasks are
+		positions := make(map[[2]int]bool)
+		for _, v := range violations {
+			positions[[2]int{v.Line, v.Column}] = true
+		}
+		invalid := make(map[*node]bool)
+		invalidTasks(root, positions, invalid)
+		references, err := resolveReferences(root, invalid, options)
+		if err != nil {
+			return nil, err
+		}
+		violations = append(violations, references...)
+		if !options.AllowDuplicates {
+			violations = append(violations, findDuplicates(root, invalid)...)
+		}
+	}
+
+	sort.SliceStable(violations, func(i, j int) bool {
+		if violations[i].Line == violations[j].Line {
+			return violations[i].Column < violations[j].Column
+		}
+		return violations[i].Line < violations[j].Line
+	})
+	return violations, nil
+}
+
+// invalidTasks collects the task elements that have a structure violation in themselves or in their definition elements,
+// the result reports a violation in n or in a definition element of n
+func invalidTasks(n *node, positions map[[2]int]bool, invalid map[*node]bool) bool {
+	found := positions[[2]int{n.Line, n.Column}]
+	for _, child := range n.Children {
+		childInvalid := invalidTasks(child, positions, invalid)
+		if contains(taskElements, child.Name) {
+			if childInvalid {
+				invalid[child] = true
+			}
+			continue
+		}
+		found = found || childInvalid
+	}
+	return found
+}
+
+func (n *node) violation(format string, args ...interface{}) Violation {
+	return Violation{
+		Line:    n.Line,
+		Column:  n.Column,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func validateNode(n *node, rule elementRule, violations *[]Violation) {
+	for _, attr := range rule.Required {
+		if strings.TrimSpace(n.Attrs[attr]) == "" {
+			*violations = append(*violations, n.violation("%s: missing required attribute %s", n.qualifiedName(), attr))
+		}
+	}
+	attrs := []string{}
+	for attr := range n.Attrs {
+		attrs = append(attrs, attr)
+	}
+	sort.Strings(attrs)
+	for _, attr := range attrs {
+		value := n.Attrs[attr]
+		if !contains(rule.Required, attr) && !contains(rule.Optional, attr) {
+			*violations = append(*violations, n.violation("%s: unknown attribute %s", n.qualifiedName(), attr))
+			continue
+		}
+		if accepted, ok := rule.Values[attr]; ok && value != "" && !contains(accepted, value) {
+			*violations = append(*violations, n.violation("%s: invalid %s %q, expected one of %s", n.qualifiedName(), attr, value, strings.Join(accepted, ", ")))
+		}
+		switch rule.Kinds[attr] {
+		case "boolean":
+			if _, err := strconv.ParseBool(value); err != nil {
+				*violations = append(*violations, n.violation("%s: attribute %s must be a boolean, found %q", n.qualifiedName(), attr, value))
+			}
+		case "integer":
+			if _, err := strconv.Atoi(value); err != nil {
+				*violations = append(*violations, n.violation("%s: attribute %s must be an integer, found %q", n.qualifiedName(), attr, value))
+			}
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, child := range n.Children {
+		counts[child.Name]++
+		if contains(rule.Single, child.Name) || contains(rule.Children, child.Name) ||
+			(rule.Tasks && contains(taskElements, child.Name)) {
+			validateNode(child, moduleRules[child.Name], violations)
+			continue
+		}
+		if (n.Name == "createField" || n.Name == "updateField") && n.Attrs["type"] == constants.FieldNumber && n.Attrs["scale"] != "" {
+			validateScaleUnit(child, violations)
+			continue
+		}
+		*violations = append(*violations, child.violation("%s: unexpected element %s", n.qualifiedName(), child.qualifiedName()))
+	}
+	for _, single := range rule.Single {
+		if counts[single] != 1 {
+			*violations = append(*violations, n.violation("%s: expected exactly one %s element, found %d", n.qualifiedName(), single, counts[single]))
+		}
+	}
+
+	switch n.Name {
+	case "options":
+		options := []*node{}
+		attrs := []map[string]string{}
+		for _, option := range n.Children {
+			if option.Name == "option" {
+				options = append(options, option)
+				attrs = append(attrs, option.Attrs)
+			}
+		}
+		for _, e := range checkDatasetOptions(attrs) {
+			option := options[e.Index]
+			*violations = append(*violations, option.violation("%s: %s", option.qualifiedName(), e.Err.Error()))
+		}
+	case "createDataset", "updateDataset":
+		if n.Attrs["type"] == constants.DatasetStatic && counts["query"] > 0 {
+			*violations = append(*violations, n.violation("%s: static dataset does not accept a query element", n.qualifiedName()))
+		}
+		if n.Attrs["type"] != constants.DatasetStatic && counts["options"] > 0 {
+			*violations = append(*violations, n.violation("%s: dynamic dataset does not accept an options element", n.qualifiedName()))
+		}
+		for _, query := range n.Children {
+			if query.Name != "query" {
+				continue
+			}
+			if _, err := parseQueryParams(query.Text); err != nil {
+				*violations = append(*violations, query.violation("%s: %s", query.qualifiedName(), err.Error()))
+			} else if _, _, err := queryColumns(query.Text); err != nil {
+				*violations = append(*violations, query.violation("%s: %s", query.qualifiedName(), err.Error()))
+			}
+		}
+		if n.Name == "updateDataset" {
+			break
+		}
+		switch n.Attrs["type"] {
+		case constants.DatasetStatic:
+			if counts["options"] != 1 {
+				*violations = append(*violations, n.violation("%s: static dataset requires exactly one options element", n.qualifiedName()))
+			}
+		case "dynamic":
+			if counts["query"] != 1 {
+				*violations = append(*violations, n.violation("%s: dynamic dataset requires exactly one query element", n.qualifiedName()))
+			}
+		}
+	case "createColumn":
+		if n.Attrs["type"] != "" && !validColumnType(n.Attrs["type"]) {
+			*violations = append(*violations, n.violation(
+				"%s: invalid column type %s, expected one of %s optionally followed by []",
+				n.qualifiedName(), n.Attrs["type"], strings.Join(columnTypes, ", "),
+			))
+		}
+		if value, ok := n.Attrs["default"]; ok && validColumnType(n.Attrs["type"]) {
+			if _, err := columnDefault(value, n.Attrs["type"]); err != nil {
+				*violations = append(*violations, n.violation("%s: %s", n.qualifiedName(), err.Error()))
+			}
+		}
+		fallthrough
+	case "dropColumn":
+		if _, err := quoteTable(n.Attrs["table"]); err != nil && n.Attrs["table"] != "" {
+			*violations = append(*violations, n.violation("%s: %s", n.qualifiedName(), err.Error()))
+		}
+		if _, err := quoteIdentifier(n.Attrs["code"]); err != nil && n.Attrs["code"] != "" {
+			*violations = append(*violations, n.violation("%s: %s", n.qualifiedName(), err.Error()))
+		}
+	case "filter", "param":
+		if contains(valueTypes, n.Attrs["valueType"]) || n.Attrs["valueType"] == "" {
+			if _, err := castAttrValue(n.Attrs); err != nil {
+				*violations = append(*violations, n.violation("%s: %s", n.qualifiedName(), err.Error()))
+			}
+		}
+	case "createIndex", "createConstraint":
+		validateConstraint(n, violations)
+	case "createField":
+		if n.Attrs["type"] == constants.FieldLookup && counts["dataset"] != 1 {
+			*violations = append(*violations, n.violation("%s: lookup field requires exactly one dataset element", n.qualifiedName()))
+		}
+		if _, ok := n.Attrs["currency"]; !ok && n.Attrs["type"] == fieldMoney {
+			*violations = append(*violations, n.violation("%s: money field requires the currency attribute", n.qualifiedName()))
+		}
+		if n.Attrs["type"] == fieldFormula && counts["expression"] != 1 {
+			*violations = append(*violations, n.violation("%s: formula field requires exactly one expression element", n.qualifiedName()))
+		}
+		fallthrough
+	case "updateField":
+		validateFieldAttributes(n, violations)
+		if counts["accept"] > 0 && n.Attrs["type"] != fieldAttachment {
+			*violations = append(*violations, n.violation("%s: %s field does not accept an accept element", n.qualifiedName(), n.Attrs["type"]))
+		}
+		if counts["expression"] > 0 && n.Attrs["type"] != fieldFormula {
+			*violations = append(*violations, n.violation("%s: %s field does not accept an expression element", n.qualifiedName(), n.Attrs["type"]))
+		}
+		if counts["expression"] > 1 {
+			*violations = append(*violations, n.violation("%s: expected at most one expression element, found %d", n.qualifiedName(), counts["expression"]))
+		}
+		if counts["default"] > 1 {
+			*violations = append(*violations, n.violation("%s: expected at most one default element, found %d", n.qualifiedName(), counts["default"]))
+		}
+		validateFieldDefault(n, violations)
+		if counts["validation"] > 1 {
+			*violations = append(*violations, n.violation("%s: expected at most one validation element, found %d", n.qualifiedName(), counts["validation"]))
+		}
+		for _, validation := range n.Children {
+			if validation.Name != "validation" || !contains(fieldTypes, n.Attrs["type"]) {
+				continue
+			}
+			if _, err := parseFieldValidations(n.Attrs["type"], validation.Attrs); err != nil {
+				*violations = append(*violations, validation.violation("%s: %s", validation.qualifiedName(), err.Error()))
+			}
+		}
+		if counts["accept"] > 1 {
+			*violations = append(*violations, n.violation("%s: expected at most one accept element, found %d", n.qualifiedName(), counts["accept"]))
+		}
+		if n.Attrs["type"] == fieldAttachment {
+			validateAttachment(n, violations)
+		}
+	case "dataset":
+		if n.Attrs["type"] == "" || n.Attrs["type"] == constants.FieldLookupStatic {
+			break
+		}
+		if counts["fields"] != 1 {
+			*violations = append(*violations, n.violation("%s: %s lookup requires exactly one fields element", n.qualifiedName(), n.Attrs["type"]))
+			break
+		}
+		codes := []string{}
+		for _, fields := range n.Children {
+			for _, field := range fields.Children {
+				if fields.Name == "fields" {
+					codes = append(codes, field.Attrs["code"])
+				}
+			}
+		}
+		for _, attr := range []string{"label", "value"} {
+			if _, _, err := lookupAttribute(n.Attrs, attr, codes); err != nil {
+				*violations = append(*violations, n.violation("%s: %s", n.qualifiedName(), err.Error()))
+			}
+		}
+	}
+}
+
+// fieldAttributes lists the field types accepting each type specific attribute
+var fieldAttributes = map[string][]string{
+	"decimals":   {constants.FieldNumber, fieldMoney, fieldPercentage, fieldFormula},
+	"scale":      {constants.FieldNumber},
+	"format":     {constants.FieldDate},
+	"timezone":   {constants.FieldDate},
+	"maxLength":  {fieldTextArea},
+	"currency":   {fieldMoney},
+	"maxSize":    {fieldAttachment},
+	"maxFiles":   {fieldAttachment},
+	"thumbnail":  {fieldAttachment},
+	"resultType": {fieldFormula},
+}
+
+func validateFieldAttributes(n *node, violations *[]Violation) {
+	fieldType := n.Attrs["type"]
+	if !contains(fieldTypes, fieldType) {
+		return
+	}
+	for _, attr := range sortedKeys(fieldAttributes) {
+		if _, ok := n.Attrs[attr]; ok && !contains(fieldAttributes[attr], fieldType) {
+			*violations = append(*violations, n.violation("%s: %s field does not accept the %s attribute", n.qualifiedName(), fieldType, attr))
+		}
+	}
+	if value, ok := n.Attrs["currency"]; ok && !currencyPattern.MatchString(value) {
+		*violations = append(*violations, n.violation("%s: invalid currency %s, expected an ISO 4217 code", n.qualifiedName(), value))
+	}
+	if value, err := strconv.Atoi(n.Attrs["maxLength"]); err == nil && value <= 0 {
+		*violations = append(*violations, n.violation("%s: maxLength must be greater than zero", n.qualifiedName()))
+	}
+	if fieldType == constants.FieldDate {
+		validateDateAttributes(n, violations)
+	}
+}
+
+func validateDateAttributes(n *node, violations *[]Violation) {
+	display, ok := n.Attrs["display"]
+	if !ok {
+		display = dateDisplayDateTime
+	}
+	if format, ok := n.Attrs["format"]; ok {
+		if err := parseDateFormat(format, display); err != nil {
+			*violations = append(*violations, n.violation("%s: %s", n.qualifiedName(), err.Error()))
+		}
+	} else if !contains(dateDisplays, display) {
+		*violations = append(*violations, n.violation("%s: invalid display %s, expected one of %s", n.qualifiedName(), display, strings.Join(dateDisplays, ", ")))
+	}
+	if timezone, ok := n.Attrs["timezone"]; ok {
+		if err := parseTimezone(timezone); err != nil {
+			*violations = append(*violations, n.violation("%s: %s", n.qualifiedName(), err.Error()))
+		}
+	}
+}
+
+func validateFieldDefault(n *node, violations *[]Violation) {
+	fieldType := n.Attrs["type"]
+	if !contains(fieldTypes, fieldType) {
+		return
+	}
+	display, ok := n.Attrs["display"]
+	if !ok {
+		display = dateDisplayDateTime
+	}
+	if value, ok := n.Attrs["default"]; ok {
+		if _, err := parseDefaultValue(fieldType, display, value); err != nil {
+			*violations = append(*violations, n.violation("%s: %s", n.qualifiedName(), err.Error()))
+		}
+	}
+	for _, child := range n.Children {
+		if child.Name != "default" {
+			continue
+		}
+		if _, ok := n.Attrs["default"]; ok {
+			*violations = append(*violations, child.violation("%s: default must be set either by the attribute or by the element", child.qualifiedName()))
+		} else if _, err := parseDefaultExpression(fieldType, display, child.Text); err != nil {
+			*violations = append(*violations, child.violation("%s: %s", child.qualifiedName(), err.Error()))
+		}
+	}
+}
+
+func validateAttachment(n *node, violations *[]Violation) {
+	if value, ok := n.Attrs["maxSize"]; ok {
+		if _, err := parseSize(value); err != nil {
+			*violations = append(*violations, n.violation("%s: %s, expected an integer optionally followed by B, KB, MB or GB", n.qualifiedName(), err.Error()))
+		}
+	}
+	if value, err := strconv.Atoi(n.Attrs["maxFiles"]); err == nil && value <= 0 {
+		*violations = append(*violations, n.violation("%s: maxFiles must be greater than zero", n.qualifiedName()))
+	}
+	mimeTypes := []string{}
+	for _, accept := range n.Children {
+		if accept.Name != "accept" {
+			continue
+		}
+		for _, mime := range accept.Children {
+			mimeType, ok := mime.Attrs["type"]
+			if !ok {
+				continue
+			}
+			if !mimePattern.MatchString(mimeType) {
+				*violations = append(*violations, mime.violation("%s: invalid mime type %s", mime.qualifiedName(), mimeType))
+			} else if contains(mimeTypes, mimeType) {
+				*violations = append(*violations, mime.violation("%s: duplicate mime type %s", mime.qualifiedName(), mimeType))
+			}
+			mimeTypes = append(mimeTypes, mimeType)
+		}
+	}
+	if n.Attrs["thumbnail"] == "true" && len(mimeTypes) > 0 {
+		for _, mimeType := range mimeTypes {
+			if strings.HasPrefix(mimeType, "image/") {
+				return
+			}
+		}
+		*violations = append(*violations, n.violation("%s: thumbnail requires at least one image mime type", n.qualifiedName()))
+	}
+}
+
+// validateConstraint checks the identifiers and the attributes each kind of index or constraint requires
+func validateConstraint(n *node, violations *[]Violation) {
+	required := []string{"columns"}
+	forbidden := []string{}
+	switch n.Attrs["type"] {
+	case constraintCheck:
+		required = []string{"expression"}
+		forbidden = []string{"columns", "referencesTable", "referencesColumns", "onDelete"}
+	case constraintForeignKey:
+		required = []string{"columns", "referencesTable", "referencesColumns"}
+		forbidden = []string{"expression"}
+	case constraintUnique:
+		forbidden = []string{"expression", "referencesTable", "referencesColumns", "onDelete"}
+	}
+	for _, attr := range required {
+		if _, ok := n.Attrs[attr]; !ok && n.Name == "createConstraint" {
+			*violations = append(*violations, n.violation("%s: %s constraint requires the %s attribute", n.qualifiedName(), n.Attrs["type"], attr))
+		}
+	}
+	for _, attr := range forbidden {
+		if _, ok := n.Attrs[attr]; ok {
+			*violations = append(*violations, n.violation("%s: %s constraint does not accept the %s attribute", n.qualifiedName(), n.Attrs["type"], attr))
+		}
+	}
+
+	for _, attr := range []string{"table", "referencesTable"} {
+		if value, ok := n.Attrs[attr]; ok && value != "" {
+			if _, err := quoteTable(value); err != nil {
+				*violations = append(*violations, n.violation("%s: %s", n.qualifiedName(), err.Error()))
+			}
+		}
+	}
+	if _, err := quoteIdentifier(n.Attrs["code"]); err != nil && n.Attrs["code"] != "" {
+		*violations = append(*violations, n.violation("%s: %s", n.qualifiedName(), err.Error()))
+	}
+	for _, attr := range []string{"columns", "referencesColumns"} {
+		if value, ok := n.Attrs[attr]; ok {
+			if _, err := quoteColumns(value); err != nil {
+				*violations = append(*violations, n.violation("%s: %s %s", n.qualifiedName(), attr, err.Error()))
+			}
+		}
+	}
+	for _, attr := range []string{"where", "expression"} {
+		if value, ok := n.Attrs[attr]; ok {
+			if err := validateExpression(value); err != nil {
+				*violations = append(*violations, n.violation("%s: %s %s", n.qualifiedName(), attr, err.Error()))
+			}
+		}
+	}
+}
+
+func validateScaleUnit(n *node, violations *[]Violation) {
+	for attr := range n.Attrs {
+		*violations = append(*violations, n.violation("%s: unknown attribute %s", n.qualifiedName(), attr))
+	}
+	for _, child := range n.Children {
+		value, ok := child.Attrs["value"]
+		if !ok || len(child.Attrs) != 1 {
+			*violations = append(*violations, child.violation("%s: scale rate requires only the value attribute", child.qualifiedName()))
+		} else if _, err := strconv.ParseFloat(value, 64); err != nil {
+			*violations = append(*violations, child.violation("%s: scale rate must be a number, found %q", child.qualifiedName(), value))
+		}
+		if len(child.Children) > 0 {
+			*violations = append(*violations, child.violation("%s: scale rate must not have child elements", child.qualifiedName()))
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedKeys returns the keys of a map with string keys in ascending order
+func sortedKeys(values interface{}) []string {
+	keys := []string{}
+	for _, key := range reflect.ValueOf(values).MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// readNodes builds the node tree keeping the line and column of every element
+func readNodes(data []byte) (*node, error) {
+	decoder := encodingXML.NewDecoder(bytes.NewReader(data))
+	stack := []*node{}
+	var root *node
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			line, column := position(data, decoder.InputOffset())
+			return nil, fmt.Errorf("%d:%d: %s", line, column, err.Error())
+		}
+		switch t := token.(type) {
+		case encodingXML.StartElement:
+			n := &node{
+				Name:   t.Name.Local,
+				Prefix: t.Name.Space,
+				Attrs:  make(map[string]string),
+			}
+			n.Line, n.Column = position(data, offset)
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+					continue
+				}
+				n.Attrs[attr.Name.Local] = attr.Value
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, n)
+			} else {
+				root = n
+			}
+			stack = append(stack, n)
+		case encodingXML.EndElement:
+			stack = stack[:len(stack)-1]
+		case encodingXML.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].Text += string(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("empty xml document")
+	}
+	return root, nil
+}
+
+func position(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
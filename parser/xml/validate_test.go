@@ -0,0 +1,266 @@
+package xml
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testModule wraps task elements in a module with a content whose tables start with sys_mdl_tst_,
+// the first task element is on line 5
+func testModule(tasks string) string {
+	return `<horizon:module version="1.0">
+  <definition languageCode="en-us" contentPackage="mdl_tst" />
+  <tasks>
+    <task:createContent code="mdl_tst" name="Test" prefix="tst" module="true" system="true">
+` + tasks + `
+    </task:createContent>
+  </tasks>
+</horizon:module>
+`
+}
+
+// writeModule saves a module xml in a temporary directory and returns its path
+func writeModule(t *testing.T, module string) string {
+	t.Helper()
+	xmlFile := filepath.Join(t.TempDir(), "module.xml")
+	if err := ioutil.WriteFile(xmlFile, []byte(module), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return xmlFile
+}
+
+type expectedViolation struct {
+	Line    int
+	Message string
+}
+
+// checkViolations validates a module and expects exactly one violation per expected line and message part
+func checkViolations(t *testing.T, module string, options Options, expected []expectedViolation) {
+	t.Helper()
+	checkFileViolations(t, writeModule(t, module), options, expected)
+}
+
+// checkFileViolations is checkViolations for a module already saved with the files it references
+func checkFileViolations(t *testing.T, xmlFile string, options Options, expected []expectedViolation) {
+	t.Helper()
+	violations, err := Validate(xmlFile, options)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	found := []string{}
+	for _, v := range violations {
+		found = append(found, v.String())
+	}
+	for _, e := range expected {
+		matched := false
+		for _, v := range violations {
+			if v.Line == e.Line && strings.Contains(v.Message, e.Message) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			t.Errorf("expected %d: %s, found\n%s", e.Line, e.Message, strings.Join(found, "\n"))
+		}
+	}
+	if len(violations) != len(expected) {
+		t.Errorf("expected %d violations, found %d\n%s", len(expected), len(violations), strings.Join(found, "\n"))
+	}
+}
+
+func TestValidateValidModule(t *testing.T) {
+	checkViolations(t, testModule(`
+      <task:createSchema code="tasks" name="Tasks">
+        <task:createField schemaCode="sys_mdl_tst_tasks" type="text" code="title" name="Title" />
+      </task:createSchema>`), Options{}, nil)
+}
+
+func TestValidateStructure(t *testing.T) {
+	tests := []struct {
+		name     string
+		tasks    string
+		expected []expectedViolation
+	}{
+		{
+			name:     "unknown attribute",
+			tasks:    `<task:createSchema code="tasks" name="Tasks" color="red" />`,
+			expected: []expectedViolation{{5, "task:createSchema: unknown attribute color"}},
+		},
+		{
+			name:     "missing required attribute",
+			tasks:    `<task:createSchema code="tasks" />`,
+			expected: []expectedViolation{{5, "task:createSchema: missing required attribute name"}},
+		},
+		{
+			name:     "value outside the accepted list",
+			tasks:    `<task:createField schemaCode="sys_mdl_tst_tasks" type="colour" code="color" name="Color" />`,
+			expected: []expectedViolation{{5, `invalid type "colour", expected one of`}},
+		},
+		{
+			name:     "boolean attribute",
+			tasks:    `<task:createColumn table="sys_mdl_tst_tasks" type="text" code="notes" ifNotExists="maybe" />`,
+			expected: []expectedViolation{{5, `attribute ifNotExists must be a boolean, found "maybe"`}},
+		},
+		{
+			name: "integer attribute",
+			tasks: `<task:createSchema code="tasks" name="Tasks">
+        <task:createField schemaCode="sys_mdl_tst_tasks" type="textarea" code="notes" name="Notes" maxLength="ten" />
+      </task:createSchema>`,
+			expected: []expectedViolation{{6, `attribute maxLength must be an integer, found "ten"`}},
+		},
+		{
+			name: "unexpected element",
+			tasks: `<task:createSchema code="tasks" name="Tasks">
+        <color value="red" />
+      </task:createSchema>`,
+			expected: []expectedViolation{{6, "task:createSchema: unexpected element color"}},
+		},
+		{
+			name:     "unknown task element",
+			tasks:    `<task:createReport code="report" />`,
+			expected: []expectedViolation{{5, "task:createContent: unexpected element task:createReport"}},
+		},
+		{
+			name: "static dataset with a query",
+			tasks: `<task:createDataset type="static" code="ds_tst_status" name="Status">
+        <query>select 1 as code</query>
+        <options>
+          <option code="open" name="Open" />
+        </options>
+      </task:createDataset>`,
+			expected: []expectedViolation{{5, "static dataset does not accept a query element"}},
+		},
+		{
+			name:     "dynamic dataset without a query",
+			tasks:    `<task:createDataset type="dynamic" code="ds_tst_users" name="Users" />`,
+			expected: []expectedViolation{{5, "dynamic dataset requires exactly one query element"}},
+		},
+		{
+			name: "lookup field without a dataset",
+			tasks: `<task:createSchema code="tasks" name="Tasks">
+        <task:createField schemaCode="sys_mdl_tst_tasks" type="lookup" code="owner" name="Owner" />
+      </task:createSchema>`,
+			expected: []expectedViolation{{6, "lookup field requires exactly one dataset element"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkViolations(t, testModule(test.tasks), Options{}, test.expected)
+		})
+	}
+}
+
+func TestValidateModuleElement(t *testing.T) {
+	tests := []struct {
+		name     string
+		module   string
+		expected []expectedViolation
+	}{
+		{
+			name:     "wrong root element",
+			module:   `<horizon:package version="1.0" />`,
+			expected: []expectedViolation{{1, "root element must be horizon:module, found horizon:package"}},
+		},
+		{
+			name: "missing definition",
+			module: `<horizon:module version="1.0">
+  <tasks />
+</horizon:module>`,
+			expected: []expectedViolation{{1, "horizon:module: expected exactly one definition element, found 0"}},
+		},
+		{
+			name: "definition without content package",
+			module: `<horizon:module version="1.0">
+  <definition languageCode="en-us" />
+  <tasks />
+</horizon:module>`,
+			expected: []expectedViolation{{2, "definition: missing required attribute contentPackage"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkViolations(t, test.module, Options{}, test.expected)
+		})
+	}
+}
+
+func TestValidateMalformedXML(t *testing.T) {
+	tests := []struct {
+		module string
+		err    string
+	}{
+		{"", "empty xml document"},
+		{"<horizon:module>\n  <tasks>\n</horizon:module>", "3:"},
+	}
+	for _, test := range tests {
+		_, err := Validate(writeModule(t, test.module), Options{})
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: expected error %s, found %v", test.module, test.err, err)
+		}
+	}
+}
+
+func TestValidateChecksTasksNestedInInvalidTasks(t *testing.T) {
+	tests := []struct {
+		name     string
+		module   string
+		expected []expectedViolation
+	}{
+		{
+			name: "unknown task in a schema hiding a duplicate field",
+			module: testModule(`<task:createSchema code="tasks" name="Tasks">
+        <task:unknownTask code="x" />
+        <task:createField schemaCode="sys_mdl_tst_tasks" type="text" code="title" name="Title" />
+        <task:createField schemaCode="sys_mdl_tst_tasks" type="text" code="title" name="Title" />
+      </task:createSchema>`),
+			expected: []expectedViolation{
+				{6, "task:createSchema: unexpected element task:unknownTask"},
+				{8, "duplicate createField sys_mdl_tst_tasks.title"},
+			},
+		},
+		{
+			name: "invalid content attribute hiding a formula cycle",
+			module: `<horizon:module version="1.0">
+  <definition languageCode="en-us" contentPackage="mdl_tst" />
+  <tasks>
+    <task:createContent code="mdl_tst" name="Test" prefix="tst" module="true" system="true" color="red">
+      <task:createSchema code="tasks" name="Tasks">
+        <task:createField schemaCode="sys_mdl_tst_tasks" type="formula" code="a" name="A" resultType="number"><expression>b + 1</expression></task:createField>
+        <task:createField schemaCode="sys_mdl_tst_tasks" type="formula" code="b" name="B" resultType="number"><expression>a + 1</expression></task:createField>
+      </task:createSchema>
+    </task:createContent>
+  </tasks>
+</horizon:module>`,
+			expected: []expectedViolation{
+				{4, "task:createContent: unknown attribute color"},
+				{7, "formula cycle a -> b -> a"},
+			},
+		},
+		{
+			name: "invalid schema still resolving the references of its fields",
+			module: testModule(`<task:createSchema code="tasks" name="Tasks" color="red">
+        <task:createField schemaCode="sys_mdl_tst_other" type="text" code="title" name="Title" />
+      </task:createSchema>`),
+			expected: []expectedViolation{
+				{5, "task:createSchema: unknown attribute color"},
+				{6, "schema sys_mdl_tst_other is not defined"},
+			},
+		},
+		{
+			name: "invalid field references are not reported",
+			module: testModule(`<task:createSchema code="tasks" name="Tasks">
+        <task:createField schemaCode="sys_mdl_tst_other" type="text" code="title" name="Title" color="red" />
+      </task:createSchema>`),
+			expected: []expectedViolation{
+				{6, "task:createField: unknown attribute color"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkViolations(t, test.module, Options{}, test.expected)
+		})
+	}
+}
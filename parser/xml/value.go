@@ -0,0 +1,134 @@
+package xml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// Value types accepted by the valueType attribute of lookup filters and params
+const (
+	valueString   = "string"
+	valueInteger  = "integer"
+	valueDecimal  = "decimal"
+	valueBoolean  = "boolean"
+	valueDate     = "date"
+	valueDatetime = "datetime"
+	valueList     = "list"
+	valueNull     = "null"
+	// valueNumber is kept for modules written before integer and decimal existed and is cast as a decimal
+	valueNumber = "number"
+	// valueTime is only used for the defaults of date fields with the time display
+	valueTime = "time"
+)
+
+var valueTypes = []string{
+	valueString, valueInteger, valueDecimal, valueBoolean, valueDate, valueDatetime, valueList, valueNull, valueNumber,
+}
+
+// castValue converts a value to its value type and reports values that do not match it
+func castValue(value, valueType string) (interface{}, error) {
+	switch valueType {
+	case valueString:
+		return value, nil
+	case valueInteger:
+		result, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", value)
+		}
+		return result, nil
+	case valueDecimal, valueNumber:
+		result, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a decimal", value)
+		}
+		return result, nil
+	case valueBoolean:
+		result, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", value)
+		}
+		return result, nil
+	case valueDate:
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			return nil, fmt.Errorf("%q is not a date as YYYY-MM-DD", value)
+		}
+		return value, nil
+	case valueTime:
+		if _, err := time.Parse("15:04", value); err != nil {
+			if _, err := time.Parse("15:04:05", value); err != nil {
+				return nil, fmt.Errorf("%q is not a time as HH:MM or HH:MM:SS", value)
+			}
+		}
+		return value, nil
+	case valueDatetime:
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			return nil, fmt.Errorf("%q is not a datetime as RFC 3339", value)
+		}
+		return value, nil
+	case valueNull:
+		if value != "" {
+			return nil, fmt.Errorf("null value must be empty, found %q", value)
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown value type %s", valueType)
+}
+
+// castList splits a comma separated value and casts every item to the item type
+func castList(value, itemType string) ([]interface{}, error) {
+	if itemType == valueList || itemType == valueNull {
+		return nil, fmt.Errorf("list items can not be of type %s", itemType)
+	}
+	items := []interface{}{}
+	if strings.TrimSpace(value) == "" {
+		return items, nil
+	}
+	for _, item := range strings.Split(value, ",") {
+		result, err := castValue(strings.TrimSpace(item), itemType)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, result)
+	}
+	return items, nil
+}
+
+// castAttrValue casts the value attribute using the valueType and itemType attributes, string is the default type
+func castAttrValue(attrs map[string]string) (interface{}, error) {
+	valueType := attrs["valueType"]
+	if valueType == "" {
+		valueType = valueString
+	}
+	if _, ok := attrs["itemType"]; ok && valueType != valueList {
+		return nil, fmt.Errorf("itemType requires valueType list")
+	}
+	if valueType == valueList {
+		itemType := attrs["itemType"]
+		if itemType == "" {
+			itemType = valueString
+		}
+		return castList(attrs["value"], itemType)
+	}
+	return castValue(attrs["value"], valueType)
+}
+
+// castElementValue casts the value of an element reporting the path of the element when it is invalid
+func castElementValue(element *etree.Element, path string) (interface{}, error) {
+	value, err := castAttrValue(elementAttrs(element))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	return value, nil
+}
+
+func elementAttrs(element *etree.Element) map[string]string {
+	attrs := make(map[string]string)
+	for _, attr := range element.Attr {
+		attrs[attr.Key] = attr.Value
+	}
+	return attrs
+}
@@ -4,7 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
 
+	"github.com/agile-work/cli/action"
 	"github.com/beevik/etree"
 )
 
@@ -15,12 +19,21 @@ type xml struct {
 	Params       map[string]interface{} `json:"params"`
 	Tasks        []task                 `json:"tasks"`
 	Translations *translation           `json:"-"`
+	Removed      []string               `json:"-"`
+	// Dir is the folder of the module xml used to resolve the files it references
+	Dir string `json:"-"`
 }
 type task struct {
+	Type        string      `json:"type"`
+	Code        string      `json:"code"`
 	Sequence    int         `json:"sequence"`
 	ExecAction  string      `json:"exec_action"`
 	ExecAddress string      `json:"exec_address"`
 	ExecPayload interface{} `json:"exec_payload"`
+	IfExists    bool        `json:"if_exists,omitempty"`
+	// Path and Element identify the xml element that produced the task
+	Path    string         `json:"-"`
+	Element *etree.Element `json:"-"`
 }
 
 func (x *xml) load(element *etree.Element) {
@@ -37,46 +50,76 @@ func (x *xml) load(element *etree.Element) {
 }
 
 // Process start xml parse
-func Process(xmlFile, translationFile, jsonFile string) error {
+func Process(xmlFile, translationFile, jsonFile string, options Options) error {
 	fmt.Println("Starting xml parse")
+	x, err := parse(xmlFile, translationFile, options)
+	if err != nil {
+		return err
+	}
+
+	if translationFile != "" {
+		if err := x.createTranslation(translationFile); err != nil {
+			return err
+		}
+	}
+
+	if jsonFile != "" {
+		if err := x.save(jsonFile); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("Finished xml parse")
+
+	return nil
+}
+
+func parse(xmlFile, translationFile string, options Options) (*xml, error) {
+	violations, err := Validate(xmlFile, options)
+	if err != nil {
+		return nil, err
+	}
+	if len(violations) > 0 {
+		messages := []string{}
+		for _, v := range violations {
+			messages = append(messages, fmt.Sprintf("%s:%s", xmlFile, v.String()))
+		}
+		return nil, fmt.Errorf("invalid module xml:\n%s", strings.Join(messages, "\n"))
+	}
+
 	doc := etree.NewDocument()
 	if err := doc.ReadFromFile(xmlFile); err != nil {
-		return err
+		return nil, err
 	}
 
 	root := doc.Root()
 	tasks := root.SelectElement("tasks")
 
-	x := &xml{}
+	x := &xml{Dir: filepath.Dir(xmlFile)}
 	x.load(root)
 
 	if err := x.Translations.loadCSV(translationFile); err != nil {
-		return err
+		return nil, err
 	}
 
 	if err := x.processTask(tasks.ChildElements(), -1, tasks.GetPath()); err != nil {
-		return err
+		return nil, err
 	}
 
-	if translationFile != "" {
-		if err := x.createTranslation(translationFile); err != nil {
-			return err
-		}
-	}
+	x.invalidateTranslations()
 
-	if jsonFile != "" {
-		jobByte, err := json.MarshalIndent(x, "", "  ")
-		if err != nil {
-			return err
-		}
-		if err := ioutil.WriteFile(jsonFile, jobByte, 0644); err != nil {
-			return err
-		}
+	if err := x.verifyPayloads(); err != nil {
+		return nil, err
 	}
+	return x, nil
+}
 
-	fmt.Println("Finished xml parse")
-
-	return nil
+func (x *xml) save(jsonFile string) error {
+	jobByte, err := json.MarshalIndent(x, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(jsonFile, jobByte, 0644)
 }
 
 func (x *xml) processTask(childElements []*etree.Element, taskSequence int, path string) error {
@@ -103,6 +146,16 @@ func (x *xml) processTask(childElements []*etree.Element, taskSequence int, path
 				return err
 			}
 			break
+		case "createIndex":
+			if err := createIndex(x, element, taskSequence, path); err != nil {
+				return err
+			}
+			break
+		case "createConstraint":
+			if err := createConstraint(x, element, taskSequence, path); err != nil {
+				return err
+			}
+			break
 		case "createFeature":
 			if err := createFeature(x, element, taskSequence, path); err != nil {
 				return err
@@ -113,7 +166,84 @@ func (x *xml) processTask(childElements []*etree.Element, taskSequence int, path
 				return err
 			}
 			break
+		case "updateSchema":
+			if err := updateSchema(x, element, taskSequence, path); err != nil {
+				return err
+			}
+			break
+		case "updateField":
+			if err := updateField(x, element, taskSequence, path); err != nil {
+				return err
+			}
+			break
+		case "updateDataset":
+			if err := updateDataset(x, element, taskSequence, path); err != nil {
+				return err
+			}
+			break
+		case "deleteContent":
+			if err := deleteContent(x, element, taskSequence); err != nil {
+				return err
+			}
+			break
+		case "deleteSchema":
+			if err := deleteSchema(x, element, taskSequence); err != nil {
+				return err
+			}
+			break
+		case "deleteField":
+			if err := deleteField(x, element, taskSequence); err != nil {
+				return err
+			}
+			break
+		case "deleteDataset":
+			if err := deleteDataset(x, element, taskSequence); err != nil {
+				return err
+			}
+			break
+		case "deleteFeature":
+			if err := deleteFeature(x, element, taskSequence); err != nil {
+				return err
+			}
+			break
+		case "dropColumn":
+			if err := dropColumn(x, element, taskSequence); err != nil {
+				return err
+			}
+			break
 		}
 	}
 	return nil
 }
+
+// verifyPayloads ensures every task payload is encoded as valid json
+func (x *xml) verifyPayloads() error {
+	for index, t := range x.Tasks {
+		payloadByte, err := json.Marshal(t.ExecPayload)
+		if err != nil {
+			return fmt.Errorf("task %d %s %s: %s", index, t.Type, t.Code, err.Error())
+		}
+		var payload interface{}
+		if err := json.Unmarshal(payloadByte, &payload); err != nil {
+			return fmt.Errorf("task %d %s %s: invalid payload %s", index, t.Type, t.Code, err.Error())
+		}
+	}
+	return nil
+}
+
+// deleteTask returns the task that removes an entity through the admin api
+func deleteTask(element *etree.Element, taskSequence int, code, address string) (task, error) {
+	elmIfExists := element.SelectAttrValue("ifExists", "false")
+	ifExists, err := strconv.ParseBool(elmIfExists)
+	if err != nil {
+		return task{}, fmt.Errorf("%s %s: invalid ifExists attribute %s", element.Tag, code, elmIfExists)
+	}
+	return task{
+		Type:        element.Tag,
+		Code:        code,
+		Sequence:    taskSequence,
+		ExecAction:  action.ExecuteAPIDelete,
+		ExecAddress: address,
+		IfExists:    ifExists,
+	}, nil
+}